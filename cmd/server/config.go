@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+)
+
+const configUsage = `usage: golang-jwt-auth [--config file] config <command>
+
+commands:
+  print               print the effective settings with secrets redacted,
+                      then report any that are invalid`
+
+// runConfig implements the config subcommand.
+func runConfig(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s", configUsage)
+	}
+
+	cfg := config.Current()
+	switch args[0] {
+	case "print":
+		if err := cfg.WriteRedacted(os.Stdout); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown config command %q\n\n%s", args[0], configUsage)
+	}
+}
@@ -2,52 +2,209 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/handlers"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/metrics"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/migrations"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"golang.org/x/time/rate"
 )
 
 func main() {
-	if err := config.LoadConfig(); err != nil {
+	configFile := flag.String("config", "", "read settings from this YAML, JSON, TOML or .env file instead of ./.env")
+	flag.Parse()
+
+	if err := config.LoadConfig(*configFile); err != nil {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
-	fmt.Println("JWT SECRET Key:", config.AppConfig.JWTSecret)
-	fmt.Println("Database URL:", config.AppConfig.DatabaseURL)
+	// Command line output stays plain text. Commands run before logging is
+	// set up, so `config print` can report an invalid LOG_LEVEL or LOG_FORMAT
+	// along with every other setting.
+	if args := flag.Args(); len(args) > 0 {
+		var err error
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(args[1:])
+		case "config":
+			err = runConfig(args[1:])
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Settings read once at startup; reloadable ones are applied by the
+	// subscribers below
+	cfg := config.Current()
+
+	// The default logger also receives the output of the log package. Its
+	// level follows LOG_LEVEL when the configuration is reloaded.
+	var logLevel slog.LevelVar
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Error configuring logging: %v", err)
+	}
+	logLevel.Set(level)
+	logger, err := logging.New(os.Stdout, cfg.LogFormat, &logLevel)
+	if err != nil {
+		log.Fatalf("Error configuring logging: %v", err)
+	}
+	slog.SetDefault(logger)
 
-	if config.AppConfig.DatabaseURL == "" {
-		log.Fatal("DATABASE_URL environment variable is not set")
+	if err := cfg.Validate(); err != nil {
+		fatal(logger, "invalid configuration", "error", err)
 	}
 
-	err := config.InitDB(config.AppConfig.DatabaseURL)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     cfg.TracingExporter,
+		OTLPEndpoint: cfg.OTLPEndpoint,
+		SampleRatio:  cfg.TracingSampleRatio,
+	})
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		fatal(logger, "failed to set up tracing", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	// Readiness checks are added below for the chosen storage backend
+	healthHandler := handlers.NewHealthHandler(readinessCheckTimeout, logger)
+
+	// Database state is checked at most this often, not on every probe
+	healthCheckInterval := time.Duration(cfg.DBHealthCheckInterval) * time.Second
+
+	var store models.Store
+	switch cfg.StorageBackend {
+	case "memory":
+		logger.Warn("using in-memory storage, data will be lost on shutdown")
+		store = models.NewMemoryStore()
+	case "postgres":
+		err := config.InitDB(cfg.DatabaseURL, cfg.DatabaseReplicaURLs...)
+		if err != nil {
+			fatal(logger, "failed to connect to database", "error", err)
+		}
+		defer config.DbConn.Close()
+
+		if cfg.AutoMigrate {
+			migrator, err := migrations.New(config.DbConn.SQLDB(), migrations.Postgres)
+			if err != nil {
+				fatal(logger, "failed to load migrations", "error", err)
+			}
+			applied, err := migrator.Up(context.Background())
+			if err != nil {
+				fatal(logger, "failed to run migrations", "error", err)
+			}
+			logger.Info("applied pending migrations", "count", len(applied))
+		}
+
+		// Track reachability in the background instead of on every query
+		monitorCtx, stopMonitor := context.WithCancel(context.Background())
+		defer stopMonitor()
+		go config.DbConn.MonitorHealth(monitorCtx, healthCheckInterval, min(healthCheckInterval, readinessCheckTimeout))
+
+		metrics.Registry.MustRegister(metrics.NewPoolCollector(config.DbConn.Stat, config.DbConn.Healthy))
+		store = models.NewPostgresStore(logger)
+
+		healthMigrator, err := migrations.New(config.DbConn.SQLDB(), migrations.Postgres)
+		if err != nil {
+			fatal(logger, "failed to load migrations", "error", err)
+		}
+		healthHandler.AddCheck("database", config.DbConn.CheckHealth)
+		healthHandler.AddCheck("migrations", migrationsCurrent(healthMigrator, healthCheckInterval))
+	case "sqlite":
+		sqliteStore, err := models.NewSQLiteStore(cfg.DatabaseURL, logger)
+		if err != nil {
+			fatal(logger, "failed to open sqlite database", "error", err)
+		}
+		defer sqliteStore.Close()
+
+		store = sqliteStore
+
+		healthMigrator, err := migrations.New(sqliteStore.DB(), migrations.SQLite)
+		if err != nil {
+			fatal(logger, "failed to load migrations", "error", err)
+		}
+		healthHandler.AddCheck("database", sqliteStore.DB().PingContext)
+		healthHandler.AddCheck("migrations", migrationsCurrent(healthMigrator, healthCheckInterval))
+	default:
+		fatal(logger, "unknown STORAGE_BACKEND", "storage_backend", cfg.StorageBackend)
 	}
-	defer config.DbConn.Close()
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(&models.User{})
-	userHandler := handlers.NewUserHandler(&models.User{})
+	authHandler := handlers.NewAuthHandler(store, logger)
+	userHandler := handlers.NewUserHandler(store, logger)
+	auditHandler := handlers.NewAuditHandler(store, logger)
 
 	// Initialize JWT middleware
-	utils.SetJWTSecrectKey(config.AppConfig.JWTSecret)
+	utils.SetJWTSecrectKey(cfg.JWTSecret)
+	utils.SetTokenSettings(tokenSettings(cfg))
+	healthHandler.AddCheck("signing_key", func(ctx context.Context) error {
+		if !utils.JWTSecretKeyLoaded() {
+			return errors.New("JWT signing key is not loaded")
+		}
+		return nil
+	})
 
 	// Setup router
 	router := mux.NewRouter()
+	router.Use(otelmux.Middleware(tracing.ServiceName), logging.Middleware, metrics.Middleware, utils.ReadPrimaryMiddleware)
+	router.NotFoundHandler = metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusNotFound, utils.CodeNotFound, "No route matches the request path."))
+	}))
+	router.MethodNotAllowedHandler = metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusMethodNotAllowed, utils.CodeMethodNotAllowed, "The route does not support this method."))
+	}))
 
 	// Create a rate limiter (e.g., 10 requests per second, with a burst of 20)
-	limiter := utils.NewRateLimiter(rate.Limit(config.AppConfig.RateLimitRPS), config.AppConfig.RateLimitBurst)
+	limiter := utils.NewRateLimiter(rate.Limit(cfg.RateLimitRPS), cfg.RateLimitBurst)
+
+	// Browsers may call the API from CORS_ALLOWED_ORIGINS
+	cors := utils.NewCORS(cfg.CORSAllowedOrigins)
+
+	// Apply reloaded settings that do not need a restart
+	config.Subscribe(func(previous, next *config.Config) {
+		if level, err := logging.ParseLevel(next.LogLevel); err == nil {
+			logLevel.Set(level)
+		}
+		limiter.SetLimit(rate.Limit(next.RateLimitRPS))
+		limiter.SetBurst(next.RateLimitBurst)
+		cors.SetAllowedOrigins(next.CORSAllowedOrigins)
+		utils.SetTokenSettings(tokenSettings(next))
+	})
+	config.WatchConfig()
+
+	// Prometheus metrics
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Health routes for the orchestrator
+	router.HandleFunc("/healthz", healthHandler.Liveness).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.Readiness).Methods("GET")
 
 	// Auth routes
 	router.Handle("/auth/register", utils.RateLimitMiddleware(limiter)(http.HandlerFunc(authHandler.Register))).Methods("POST")
@@ -57,17 +214,35 @@ func main() {
 
 	// user routes
 	router.Handle("/users", utils.JWTMiddleware(userHandler.GetUsers)).Methods("GET")
+	router.Handle("/users/search", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, userHandler.SearchUsers))).Methods("GET")
 	router.Handle("/users/{id}", utils.JWTMiddleware(userHandler.GetUser)).Methods("GET")
 	router.Handle("/users/{id}", utils.JWTMiddleware(userHandler.UpdateUser)).Methods("PUT")
+	router.Handle("/users/{id}", utils.JWTMiddleware(userHandler.PatchUser)).Methods("PATCH")
 	router.Handle("/users/{id}", utils.JWTMiddleware(userHandler.DeleteUser)).Methods("DELETE")
+	router.Handle("/users/{id}/restore", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, userHandler.RestoreUser))).Methods("POST")
+	router.Handle("/users/{id}/status", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, userHandler.ChangeUserStatus))).Methods("POST")
+	router.Handle("/users/{id}/status-changes", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, userHandler.ListUserStatusChanges))).Methods("GET")
+
+	// audit routes
+	router.Handle("/audit-events", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, auditHandler.ListAuditEvents))).Methods("GET")
+	router.Handle("/audit-events/verify", utils.JWTMiddleware(utils.RequireRole(models.RoleAdmin, auditHandler.VerifyAuditChain))).Methods("GET")
+
+	// Permanently remove soft deleted users after the retention period
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	if cfg.DeletedUserRetentionDays > 0 {
+		retention := time.Duration(cfg.DeletedUserRetentionDays) * 24 * time.Hour
+		interval := time.Duration(cfg.PurgeIntervalMinutes) * time.Minute
+		go runUserPurge(purgeCtx, logger, store, retention, interval)
+	}
 
 	// Start server
-	addr := ":" + config.AppConfig.ServerPort
-	log.Printf("Starting server on %s", addr)
+	addr := ":" + cfg.ServerPort
+	logger.Info("starting server", "addr", addr, "storage_backend", cfg.StorageBackend)
 
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: router,
+		Handler: logging.AccessLog(logger)(cors.Middleware(router)),
 	}
 
 	// Create a channel to listen for OS signals
@@ -77,21 +252,88 @@ func main() {
 	// Run the server in a goroutine so that it doesn't block the graceful shutdown
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+			fatal(logger, "server failed", "error", err)
 		}
 	}()
 
-	// Block until a signal is received
-	<-quit
-	log.Println("Shutting down server...")
+	// Reload the configuration on SIGHUP, and block until a shutdown signal
+	// is received
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	for waiting := true; waiting; {
+		select {
+		case <-reload:
+			if err := config.Reload(); err != nil {
+				logger.Error("failed to reload configuration", "error", err)
+			}
+		case <-quit:
+			waiting = false
+		}
+	}
+	logger.Info("shutting down server")
+
+	// Fail readiness first and keep serving while load balancers notice
+	healthHandler.StartDraining()
+	if drain := time.Duration(config.Current().ShutdownDrainSeconds) * time.Second; drain > 0 {
+		logger.Info("draining traffic", "duration", drain)
+		time.Sleep(drain)
+	}
 
 	// Create a context with a timeout for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal(logger, "server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exited gracefully")
+	logger.Info("server exited gracefully")
+}
+
+// readinessCheckTimeout bounds each check run by GET /readyz
+const readinessCheckTimeout = 2 * time.Second
+
+// migrationsCurrent returns a readiness check that fails while migrator has
+// pending migrations. Like the database check, it reuses its last result for
+// ttl rather than querying the database on every probe; errors are not
+// reused.
+func migrationsCurrent(migrator *migrations.Migrator, ttl time.Duration) handlers.HealthCheck {
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var pending int
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if checkedAt.IsZero() || time.Since(checkedAt) >= ttl {
+			count, err := migrator.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			pending, checkedAt = count, time.Now()
+		}
+
+		if pending > 0 {
+			return fmt.Errorf("%d pending migration(s)", pending)
+		}
+		return nil
+	}
+}
+
+// tokenSettings returns the token issuance and verification settings of cfg
+func tokenSettings(cfg *config.Config) utils.TokenSettings {
+	return utils.TokenSettings{
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		AccessTTL:  time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute,
+		RefreshTTL: time.Duration(cfg.RefreshTokenTTLHours) * time.Hour,
+		Leeway:     time.Duration(cfg.JWTLeewaySeconds) * time.Second,
+	}
+}
+
+// fatal logs msg at error level and exits with status 1
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
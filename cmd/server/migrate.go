@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/migrations"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+const migrateUsage = `usage: golang-jwt-auth migrate <command>
+
+commands:
+  up                  apply all pending migrations
+  down [n]            revert the last n applied migrations (default 1)
+  status              list migrations and when they were applied
+  create [-dir d] <name>
+                      write empty up/down files for a new migration
+                      (default dir: internal/migrations)`
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	if args[0] == "create" {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		dir := flags.String("dir", "internal/migrations", "directory holding the postgres and sqlite migrations")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+
+		paths, err := migrations.Create(*dir, flags.Arg(0))
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return err
+	}
+
+	db, dialect, err := openMigrationDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+}
+
+// openMigrationDB opens the configured database without touching its schema.
+func openMigrationDB() (*sql.DB, string, error) {
+	cfg := config.Current()
+	switch cfg.StorageBackend {
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			return nil, "", fmt.Errorf("DATABASE_URL environment variable is not set")
+		}
+		if err := config.InitDB(cfg.DatabaseURL); err != nil {
+			return nil, "", fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return config.DbConn.SQLDB(), migrations.Postgres, nil
+	case "sqlite":
+		db, err := models.OpenSQLiteDB(cfg.DatabaseURL)
+		return db, migrations.SQLite, err
+	default:
+		return nil, "", fmt.Errorf("STORAGE_BACKEND %q has no schema to migrate", cfg.StorageBackend)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+// runUserPurge permanently deletes users that were soft deleted more than
+// retention ago, once at startup and then every interval, until ctx is done.
+func runUserPurge(ctx context.Context, logger *slog.Logger, store models.Store, retention, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to purge deleted users", "error", err)
+		} else if purged > 0 {
+			logger.InfoContext(ctx, "purged deleted users", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package audit describes the append-only log of security-relevant events:
+// sign-ins, token refreshes and changes made to users. Every event is chained
+// to the one before it by a SHA-256 hash, so editing, removing or reordering
+// stored events is detected by Verify.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in the log
+const (
+	ActionRegister         = "auth.register"
+	ActionLogin            = "auth.login"
+	ActionLoginFailed      = "auth.login_failed"
+	ActionRefresh          = "auth.refresh"
+	ActionRefreshFailed    = "auth.refresh_failed"
+	ActionLogout           = "auth.logout"
+	ActionUserUpdate       = "user.update"
+	ActionUserDelete       = "user.delete"
+	ActionUserRestore      = "user.restore"
+	ActionUserStatusChange = "user.status_change"
+)
+
+// IsValidAction reports whether action is one of the recorded actions
+func IsValidAction(action string) bool {
+	switch action {
+	case ActionRegister, ActionLogin, ActionLoginFailed, ActionRefresh, ActionRefreshFailed, ActionLogout,
+		ActionUserUpdate, ActionUserDelete, ActionUserRestore, ActionUserStatusChange:
+		return true
+	}
+	return false
+}
+
+// Page sizes used when ListAuditEvents is given no limit or too large a limit
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid audit event cursor")
+
+// Event is a single entry of the audit log. ActorID is the user who made the
+// request and TargetID the user it concerned; either is zero when unknown,
+// such as the actor of a failed login. Diff holds the changed fields as
+// {"field": {"old": ..., "new": ...}} and is nil for events without changes.
+type Event struct {
+	ID         int64           `json:"id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	ActorID    int64           `json:"actor_id"`
+	TargetID   int64           `json:"target_id"`
+	Action     string          `json:"action"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Diff       json.RawMessage `json:"diff"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// Store persists audit events. AppendAuditEvent seals event against the hash
+// of the newest stored event and assigns its ID; appends are serialized so
+// the chain never forks. ListAuditEvents returns events newest first.
+type Store interface {
+	AppendAuditEvent(ctx context.Context, event *Event) error
+	ListAuditEvents(ctx context.Context, filter Filter) (*Page, error)
+}
+
+// Seal sets the time of event, links it to the event with hash prevHash (""
+// for the first event) and computes its hash. Stores call it while holding
+// the chain head. The time is truncated to the microsecond precision of the
+// SQL backends, so the hash can be recomputed from stored values.
+func (e *Event) Seal(prevHash string, now time.Time) {
+	e.OccurredAt = now.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prevHash
+	e.Hash = e.computeHash()
+}
+
+// computeHash returns the hex SHA-256 of the previous hash and every recorded
+// field except the ID, which the database assigns after sealing.
+func (e *Event) computeHash() string {
+	diff := e.Diff
+	if len(diff) == 0 {
+		diff = json.RawMessage("null")
+	}
+
+	canonical, _ := json.Marshal(struct {
+		PrevHash   string          `json:"prev_hash"`
+		OccurredAt string          `json:"occurred_at"`
+		ActorID    int64           `json:"actor_id"`
+		TargetID   int64           `json:"target_id"`
+		Action     string          `json:"action"`
+		IP         string          `json:"ip"`
+		UserAgent  string          `json:"user_agent"`
+		RequestID  string          `json:"request_id"`
+		Diff       json.RawMessage `json:"diff"`
+	}{e.PrevHash, e.OccurredAt.UTC().Format(time.RFC3339Nano), e.ActorID, e.TargetID, e.Action, e.IP, e.UserAgent, e.RequestID, diff})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter selects one page of events for ListAuditEvents. Zero values match
+// every event.
+type Filter struct {
+	ActorID  int64
+	TargetID int64
+	Action   string
+	Since    time.Time // events at or after Since
+	Until    time.Time // events before Until
+	Limit    int
+	BeforeID int64 // position of the cursor: only events with a smaller ID
+}
+
+// WithDefaults clamps the limit of f to MaxPageSize, defaulting to
+// DefaultPageSize.
+func (f Filter) WithDefaults() Filter {
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+	return f
+}
+
+// Matches reports whether event passes every condition of f except the
+// limit, for stores that filter in Go.
+func (f Filter) Matches(event *Event) bool {
+	switch {
+	case f.ActorID != 0 && event.ActorID != f.ActorID:
+		return false
+	case f.TargetID != 0 && event.TargetID != f.TargetID:
+		return false
+	case f.Action != "" && event.Action != f.Action:
+		return false
+	case !f.Since.IsZero() && event.OccurredAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !event.OccurredAt.Before(f.Until):
+		return false
+	case f.BeforeID != 0 && event.ID >= f.BeforeID:
+		return false
+	}
+	return true
+}
+
+// Page is a page of events, newest first, and the cursor of the next page
+type Page struct {
+	Events     []*Event
+	NextCursor string
+	HasMore    bool
+}
+
+// NewPage builds a page from up to f.Limit+1 events fetched newest first; the
+// extra event only signals that another page exists.
+func NewPage(events []*Event, f Filter) *Page {
+	page := &Page{Events: events}
+	if len(events) > f.Limit {
+		page.Events = events[:f.Limit]
+		page.HasMore = true
+		page.NextCursor = EncodeCursor(page.Events[len(page.Events)-1].ID)
+	}
+	if page.Events == nil {
+		page.Events = []*Event{}
+	}
+	return page
+}
+
+// EncodeCursor returns the opaque cursor of the page after the event with id
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor returns the event ID a cursor made by EncodeCursor points at
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// ChainError reports the first event, newest first, at which the chain is
+// broken.
+type ChainError struct {
+	EventID int64
+	Reason  string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at event %d: %s", e.EventID, e.Reason)
+}
+
+// Verify walks the whole log from the newest event to the first one and
+// checks that every event matches its hash and links to the event before it.
+// It returns the number of events checked, and a *ChainError if the chain is
+// broken. Events appended while Verify runs are not checked.
+func Verify(ctx context.Context, store Store) (int, error) {
+	checked := 0
+	var newer *Event
+	filter := Filter{Limit: MaxPageSize}
+	for {
+		page, err := store.ListAuditEvents(ctx, filter)
+		if err != nil {
+			return checked, err
+		}
+
+		for _, event := range page.Events {
+			if event.Hash != event.computeHash() {
+				return checked, &ChainError{EventID: event.ID, Reason: "hash does not match the event"}
+			}
+			if newer != nil && newer.PrevHash != event.Hash {
+				return checked, &ChainError{EventID: newer.ID, Reason: "previous hash does not match the preceding event"}
+			}
+			newer = event
+			checked++
+		}
+
+		if !page.HasMore {
+			break
+		}
+		filter.BeforeID = newer.ID
+	}
+
+	if newer != nil && newer.PrevHash != "" {
+		return checked, &ChainError{EventID: newer.ID, Reason: "first event does not start the chain"}
+	}
+
+	return checked, nil
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliceStore keeps events in memory, oldest first, without any checks
+type sliceStore struct {
+	events []*Event
+}
+
+func (s *sliceStore) AppendAuditEvent(ctx context.Context, event *Event) error {
+	prevHash := ""
+	if len(s.events) > 0 {
+		prevHash = s.events[len(s.events)-1].Hash
+	}
+	event.Seal(prevHash, time.Now())
+	event.ID = int64(len(s.events)) + 1
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *sliceStore) ListAuditEvents(ctx context.Context, filter Filter) (*Page, error) {
+	filter = filter.WithDefaults()
+	var events []*Event
+	for i := len(s.events) - 1; i >= 0 && len(events) <= filter.Limit; i-- {
+		if filter.Matches(s.events[i]) {
+			events = append(events, s.events[i])
+		}
+	}
+	return NewPage(events, filter), nil
+}
+
+func newChain(t *testing.T, n int) *sliceStore {
+	t.Helper()
+	store := &sliceStore{}
+	for i := 0; i < n; i++ {
+		event := &Event{Action: ActionLogin, ActorID: int64(i + 1), TargetID: int64(i + 1), IP: "192.0.2.1"}
+		if err := store.AppendAuditEvent(context.Background(), event); err != nil {
+			t.Fatalf("AppendAuditEvent failed: %v", err)
+		}
+	}
+	return store
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	if checked, err := Verify(ctx, &sliceStore{}); checked != 0 || err != nil {
+		t.Errorf("expected an empty log to be valid, got %d, err %v", checked, err)
+	}
+
+	// More events than fit on one page
+	store := newChain(t, MaxPageSize+5)
+	if checked, err := Verify(ctx, store); checked != MaxPageSize+5 || err != nil {
+		t.Fatalf("expected a valid chain of %d events, got %d, err %v", MaxPageSize+5, checked, err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(events []*Event) []*Event
+		brokeAt int64
+	}{
+		{"edited field", func(events []*Event) []*Event {
+			events[9].ActorID = 99
+			return events
+		}, 10},
+		{"edited diff", func(events []*Event) []*Event {
+			events[3].Diff = json.RawMessage(`{"role":{"old":"user","new":"admin"}}`)
+			return events
+		}, 4},
+		{"removed event", func(events []*Event) []*Event {
+			return append(events[:5:5], events[6:]...)
+		}, 7},
+		{"removed first event", func(events []*Event) []*Event {
+			return events[1:]
+		}, 2},
+		{"rehashed event", func(events []*Event) []*Event {
+			events[2].ActorID = 99
+			events[2].Hash = events[2].computeHash()
+			return events
+		}, 4},
+	}
+	for _, tc := range tests {
+		store := newChain(t, 10)
+		store.events = tc.tamper(store.events)
+
+		_, err := Verify(ctx, store)
+		var chainErr *ChainError
+		if !errors.As(err, &chainErr) || chainErr.EventID != tc.brokeAt {
+			t.Errorf("%s: expected the chain to break at event %d, got %v", tc.name, tc.brokeAt, err)
+		}
+	}
+}
+
+func TestSealTruncatesTime(t *testing.T) {
+	event := &Event{Action: ActionLogout}
+	event.Seal("", time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60)))
+
+	if event.OccurredAt.Nanosecond() != 123456000 || event.OccurredAt.Location() != time.UTC {
+		t.Errorf("expected a UTC time with microsecond precision, got %v", event.OccurredAt)
+	}
+
+	// The stored representation gives the same hash
+	reloaded := *event
+	reloaded.OccurredAt = event.OccurredAt.In(time.Local)
+	if reloaded.computeHash() != event.Hash {
+		t.Errorf("hash depends on the time zone the time is read in")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type profile struct {
+		Email string `json:"email"`
+		Role  string `json:"role,omitempty"`
+	}
+
+	tests := []struct {
+		name          string
+		before, after any
+		expected      string
+	}{
+		{"created", nil, profile{Email: "a@example.com"}, `{"email":{"old":null,"new":"a@example.com"}}`},
+		{"changed", profile{Email: "a@example.com", Role: "user"}, profile{Email: "b@example.com", Role: "user"}, `{"email":{"old":"a@example.com","new":"b@example.com"}}`},
+		{"removed", profile{Email: "a@example.com", Role: "user"}, profile{Email: "a@example.com"}, `{"role":{"old":"user","new":null}}`},
+		{"unchanged", profile{Email: "a@example.com"}, profile{Email: "a@example.com"}, ``},
+	}
+
+	for _, tc := range tests {
+		diff, err := Diff(tc.before, tc.after)
+		if err != nil {
+			t.Fatalf("%s: Diff failed: %v", tc.name, err)
+		}
+		if string(diff) != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, diff)
+		}
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	r := httptest.NewRequest("POST", "/auth/login", nil)
+	r.RemoteAddr = "[2001:db8::1]:54321"
+	r.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+	r.Header.Set(RequestIDHeader, "req-42")
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+
+	event := NewEvent(r, ActionLogin)
+	if event.Action != ActionLogin || event.IP != "2001:db8::1" || event.RequestID != "req-42" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if len(event.UserAgent) != maxUserAgentLength {
+		t.Errorf("expected the user agent to be cut to %d bytes, got %d", maxUserAgentLength, len(event.UserAgent))
+	}
+
+	if got := truncate("ab\xffcdé", 5); got != "abcd" {
+		t.Errorf("expected invalid UTF-8 to be dropped without splitting a character, got %q", got)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	id, err := DecodeCursor(EncodeCursor(42))
+	if err != nil || id != 42 {
+		t.Errorf("expected the cursor to round trip, got %d, err %v", id, err)
+	}
+
+	for _, cursor := range []string{"", "!!", EncodeCursor(0), "YWJj"} {
+		if _, err := DecodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q): expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
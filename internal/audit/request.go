@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+)
+
+// RequestIDHeader carries the ID clients and proxies assign to a request
+const RequestIDHeader = logging.RequestIDHeader
+
+// Bounds of the stored user agent and request ID, which clients control
+const (
+	maxUserAgentLength = 512
+	maxRequestIDLength = 128
+)
+
+// NewEvent returns an event for action with the client IP, user agent and
+// request ID of r. The ID assigned by logging.AccessLog is preferred over the
+// header, which is absent when the ID was generated. The caller sets the
+// actor, target and diff.
+func NewEvent(r *http.Request, action string) *Event {
+	requestID := logging.RequestIDFromContext(r.Context())
+	if requestID == "" {
+		requestID = r.Header.Get(RequestIDHeader)
+	}
+
+	return &Event{
+		Action:    action,
+		IP:        logging.ClientIP(r),
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLength),
+		RequestID: truncate(requestID, maxRequestIDLength),
+	}
+}
+
+// truncate drops invalid UTF-8 from s, which the databases reject, and cuts
+// it to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// fieldChange is the old and new value of one field in a diff
+type fieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// Diff compares the JSON objects before and after marshal to and returns the
+// fields that differ as {"field": {"old": ..., "new": ...}}, with a null old
+// value for fields before lacks. A nil before records a creation. The result
+// is nil when nothing changed. Callers pass response or request types, never
+// models, so secrets cannot end up in the log.
+func Diff(before, after any) (json.RawMessage, error) {
+	oldFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]fieldChange{}
+	for name, value := range newFields {
+		if old, ok := oldFields[name]; !ok || string(old) != string(value) {
+			changes[name] = fieldChange{Old: old, New: value}
+		}
+	}
+	for name, old := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			changes[name] = fieldChange{Old: old}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	// Map keys are marshalled in sorted order, so equal diffs hash equally
+	return json.Marshal(changes)
+}
+
+// jsonFields returns the members of the JSON object v marshals to
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if v == nil {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
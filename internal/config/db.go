@@ -2,66 +2,214 @@ package config
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
 )
 
-// DB wraps the pgxpool.Pool connection pool
+// DB wraps the pgxpool.Pool connection pool of the primary database and
+// those of its read replicas, if any
 type DbConnect struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	replicas []*replica
+	next     atomic.Uint64 // round-robin position in replicas
+
+	mu        sync.RWMutex
+	healthErr error // result of the last background ping, nil when healthy
 }
 
 var DbConn *DbConnect
 
-// NewDB creates a new database connection using pgxpool
-func InitDB(databaseURL string) error {
+// Bounds of the delay between connection attempts in InitDB
+const (
+	initialConnectBackoff = time.Second
+	maxConnectBackoff     = 30 * time.Second
+)
+
+// NewDB creates a new database connection using pgxpool. The database is
+// pinged up to DB_CONNECT_ATTEMPTS times, with an exponential backoff
+// between attempts, so the server can start before the database is up. A pool
+// is also created for each read replica URL; replicas that cannot be reached
+// yet are skipped by ReadPool until MonitorHealth reaches them.
+func InitDB(databaseURL string, replicaURLs ...string) error {
 	ctx := context.Background()
 
-	config, err := pgxpool.ParseConfig(databaseURL)
+	pool, err := newPool(ctx, databaseURL)
 	if err != nil {
-		return fmt.Errorf("failed to parse database URL: %w", err)
+		return err
 	}
 
-	config.MaxConns = AppConfig.MaxConns
-	config.MinConns = AppConfig.MinConns
-	config.MaxConnLifetime = time.Duration(AppConfig.MaxConnLifetime) * time.Second
+	attempts := max(Current().DBConnectAttempts, 1)
+	backoff := initialConnectBackoff
+	for attempt := 1; ; attempt++ {
+		// Ping the database to verify the connection.
+		err = pool.Ping(ctx)
+		if err == nil {
+			break
+		}
+		if attempt == attempts {
+			pool.Close()
+			return fmt.Errorf("failed to ping database after %d attempt(s): %w", attempts, err)
+		}
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
-	if err != nil {
-		return fmt.Errorf("failed to create connection pool: %w", err)
+		slog.Warn("database is not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxConnectBackoff)
 	}
 
-	// Ping the database to verify the connection.
-	if err := pool.Ping(ctx); err != nil {
-		pool.Close()
-		return fmt.Errorf("failed to ping database: %w", err)
+	replicas := make([]*replica, 0, len(replicaURLs))
+	for i, url := range replicaURLs {
+		replicaPool, err := newPool(ctx, url)
+		if err != nil {
+			pool.Close()
+			for _, r := range replicas {
+				r.pool.Close()
+			}
+			return fmt.Errorf("read replica %d: %w", i, err)
+		}
+
+		r := &replica{index: i, pool: replicaPool}
+		if err := pingWithTimeout(ctx, replicaPool, replicaConnectTimeout); err != nil {
+			slog.Warn("read replica is not reachable yet", "replica", i, "error", err)
+		} else {
+			r.healthy.Store(true)
+		}
+		replicas = append(replicas, r)
 	}
 
-	DbConn = &DbConnect{pool: pool}
-	fmt.Println("Database connection established successfully!")
+	DbConn = &DbConnect{pool: pool, replicas: replicas}
+	slog.Info("database connection established", "max_conns", pool.Config().MaxConns, "replicas", len(replicas))
 
 	return nil
 }
 
-// Close closes the database connection
+// newPool creates a pool for databaseURL with the configured limits. It does
+// not connect.
+func newPool(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+
+	settings := Current()
+	config.MaxConns = settings.MaxConns
+	config.MinConns = settings.MinConns
+	config.MaxConnLifetime = time.Duration(settings.MaxConnLifetime) * time.Second
+	config.ConnConfig.Tracer = tracing.QueryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	return pool, nil
+}
+
+// pingWithTimeout pings pool, giving up after timeout
+func pingWithTimeout(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return pool.Ping(ctx)
+}
+
+// Close closes the database connections
 func (db *DbConnect) Close() {
 	db.pool.Close()
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
 }
 
-// GetPool returns the underlying pgxpool.Pool
+// GetPool returns the underlying pgxpool.Pool. Reachability is tracked by
+// MonitorHealth rather than checked here, as this is called for every query.
 func (db *DbConnect) GetPool() *pgxpool.Pool {
 	// Check if the pool is nil or closed
 	if db == nil || db.pool == nil {
 		log.Panic("Database pool is not initialized")
 		return nil
 	}
-	if err := db.pool.Ping(context.Background()); err != nil {
-		fmt.Println("Database pool is not available:", err)
-	}
 
-	// Return the pool if it's available
 	return db.pool
 }
+
+// MonitorHealth pings the database and each read replica every interval
+// until ctx is done. The primary's result is reported by Healthy and
+// CheckHealth, and unreachable replicas are skipped by ReadPool. Each ping
+// gets at most timeout. Changes between reachable and unreachable are logged.
+func (db *DbConnect) MonitorHealth(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := pingWithTimeout(ctx, db.pool, timeout)
+			replicaErrs := make([]error, len(db.replicas))
+			for i, r := range db.replicas {
+				replicaErrs[i] = pingWithTimeout(ctx, r.pool, timeout)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			db.setHealth(err)
+			for i, r := range db.replicas {
+				r.setHealth(replicaErrs[i])
+			}
+		}
+	}
+}
+
+// setHealth records the result of a ping and logs transitions
+func (db *DbConnect) setHealth(err error) {
+	db.mu.Lock()
+	wasHealthy := db.healthErr == nil
+	db.healthErr = err
+	db.mu.Unlock()
+
+	switch {
+	case wasHealthy && err != nil:
+		slog.Error("database became unreachable", "error", err)
+	case !wasHealthy && err == nil:
+		slog.Info("database is reachable again")
+	}
+}
+
+// Healthy reports whether the last background ping succeeded. The database
+// is considered healthy until MonitorHealth reports otherwise.
+func (db *DbConnect) Healthy() bool {
+	return db.CheckHealth(context.Background()) == nil
+}
+
+// CheckHealth returns the error of the last background ping, or nil if it
+// succeeded. It does not contact the database, so readiness probes are cheap.
+func (db *DbConnect) CheckHealth(ctx context.Context) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.healthErr != nil {
+		return fmt.Errorf("database unreachable: %w", db.healthErr)
+	}
+	return nil
+}
+
+// Stat returns the current statistics of the pool, without checking that
+// the database is reachable
+func (db *DbConnect) Stat() *pgxpool.Stat {
+	return db.pool.Stat()
+}
+
+// SQLDB returns a database/sql handle backed by the pool, for code such as
+// the schema migrations that is written against database/sql.
+func (db *DbConnect) SQLDB() *sql.DB {
+	return stdlib.OpenDBFromPool(db.GetPool())
+}
@@ -1,44 +1,192 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DatabaseURL string `mapstructure:"DATABASE_URL"`
-	JWTSecret   string `mapstructure:"JWT_SECRET"`
-	ServerPort  string `mapstructure:"SERVER_PORT"`
-	MaxConns    int32  `mapstructure:"DB_MAX_CONNS"`
-	MinConns    int32  `mapstructure:"DB_MIN_CONNS"`
-	MaxConnLifetime int32 `mapstructure:"DB_MAX_CONN_LIFETIME"`
-	RateLimitRPS float64 `mapstructure:"RATE_LIMIT_RPS"`
-	RateLimitBurst int `mapstructure:"RATE_LIMIT_BURST"`
+	DatabaseURL     string  `mapstructure:"DATABASE_URL"`
+	JWTSecret       string  `mapstructure:"JWT_SECRET"`
+	ServerPort      string  `mapstructure:"SERVER_PORT"`
+	MaxConns        int32   `mapstructure:"DB_MAX_CONNS"`
+	MinConns        int32   `mapstructure:"DB_MIN_CONNS"`
+	MaxConnLifetime int32   `mapstructure:"DB_MAX_CONN_LIFETIME"`
+	RateLimitRPS    float64 `mapstructure:"RATE_LIMIT_RPS"`
+	RateLimitBurst  int     `mapstructure:"RATE_LIMIT_BURST"`
+	StorageBackend  string  `mapstructure:"STORAGE_BACKEND"`
+	AutoMigrate     bool    `mapstructure:"AUTO_MIGRATE"`
+	LogFormat       string  `mapstructure:"LOG_FORMAT"` // json or text
+	LogLevel        string  `mapstructure:"LOG_LEVEL"`  // debug, info, warn or error
+
+	// Traces are sent to TracingExporter: otlp, stdout or none. The OTLP
+	// endpoint is a URL such as http://localhost:4318; when empty the
+	// exporter falls back to its standard environment variables.
+	TracingExporter    string  `mapstructure:"TRACING_EXPORTER"`
+	TracingSampleRatio float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+	OTLPEndpoint       string  `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+
+	// Soft deleted users are purged once they have been deleted for
+	// DeletedUserRetentionDays; 0 keeps them forever.
+	DeletedUserRetentionDays int `mapstructure:"DELETED_USER_RETENTION_DAYS"`
+	PurgeIntervalMinutes     int `mapstructure:"PURGE_INTERVAL_MINUTES"`
+
+	// On shutdown readiness fails for ShutdownDrainSeconds before the server
+	// stops accepting connections, so load balancers drain it first.
+	ShutdownDrainSeconds int `mapstructure:"SHUTDOWN_DRAIN_SECONDS"`
+
+	// Connecting to Postgres is attempted DBConnectAttempts times at startup,
+	// and the database is pinged every DBHealthCheckInterval seconds after.
+	DBConnectAttempts     int `mapstructure:"DB_CONNECT_ATTEMPTS"`
+	DBHealthCheckInterval int `mapstructure:"DB_HEALTH_CHECK_INTERVAL"`
+
+	// Optional comma-separated Postgres read replicas, used for listing and
+	// searching
+	DatabaseReplicaURLs []string `mapstructure:"DATABASE_REPLICA_URLS"`
+
+	// Access tokens are issued by JWTIssuer for JWTAudience, and checked
+	// allowing JWTLeewaySeconds of clock skew
+	JWTIssuer             string `mapstructure:"JWT_ISSUER"`
+	JWTAudience           string `mapstructure:"JWT_AUDIENCE"`
+	JWTLeewaySeconds      int    `mapstructure:"JWT_LEEWAY_SECONDS"`
+	AccessTokenTTLMinutes int    `mapstructure:"ACCESS_TOKEN_TTL_MINUTES"`
+	RefreshTokenTTLHours  int    `mapstructure:"REFRESH_TOKEN_TTL_HOURS"`
+
+	// Optional comma-separated origins, such as https://app.example.com,
+	// that browsers may call the API from; * allows any origin
+	CORSAllowedOrigins []string `mapstructure:"CORS_ALLOWED_ORIGINS"`
 }
 
-var AppConfig *Config
+// current holds the settings in use. Reload replaces it as a whole, so a
+// snapshot returned by Current never changes.
+var current atomic.Pointer[Config]
 
-func LoadConfig() error {
-	viper.AddConfigPath(".")
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
+// Current returns the settings in use, or nil before LoadConfig
+func Current() *Config {
+	return current.Load()
+}
 
-	viper.AutomaticEnv()
+// secretKeys may instead be read from the file named by their _FILE variant,
+// such as JWT_SECRET_FILE, so Docker and Kubernetes secrets can be mounted
+var secretKeys = []string{"JWT_SECRET", "DATABASE_URL", "DATABASE_REPLICA_URLS"}
 
-	if err := viper.ReadInConfig(); err != nil {
-		// Don't fail if the .env file is not found
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return err
+// LoadConfig reads the settings returned by Current. They come from
+// configFile, a YAML, JSON, TOML or .env file chosen by its extension, or from
+// ./.env when configFile is empty, and environment variables override both.
+// It does not validate them; see Config.Validate.
+func LoadConfig(configFile string) error {
+	cfg, v, err := load(configFile)
+	if err != nil {
+		return err
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	loadedFile, watcher = configFile, v
+	current.Store(cfg)
+	return nil
+}
+
+// load reads the settings from configFile, or ./.env, and the environment,
+// and returns them with the viper instance that read them
+func load(configFile string) (*Config, *viper.Viper, error) {
+	v := viper.New()
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+	} else {
+		v.AddConfigPath(".")
+		v.SetConfigName(".env")
+		v.SetConfigType("env")
+	}
+
+	v.AutomaticEnv()
+
+	if err := v.ReadInConfig(); err != nil {
+		// Don't fail if the .env file is not found, but a file asked for
+		// explicitly must exist
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || configFile != "" {
+			return nil, nil, err
 		}
 	}
 
 	// Set default values
-	viper.SetDefault("SERVER_PORT", "8080")
-	viper.SetDefault("DB_MAX_CONNS", 10)
-	viper.SetDefault("DB_MIN_CONNS", 2)
-	viper.SetDefault("DB_MAX_CONN_LIFETIME", 300) // 5 minutes
-	viper.SetDefault("RATE_LIMIT_RPS", 1.0)
-	viper.SetDefault("RATE_LIMIT_BURST", 5)
-
-	err := viper.Unmarshal(&AppConfig)
-	return err
+	v.SetDefault("SERVER_PORT", "8080")
+	v.SetDefault("DB_MAX_CONNS", 10)
+	v.SetDefault("DB_MIN_CONNS", 2)
+	v.SetDefault("DB_MAX_CONN_LIFETIME", 300) // 5 minutes
+	v.SetDefault("DB_CONNECT_ATTEMPTS", 5)
+	v.SetDefault("DB_HEALTH_CHECK_INTERVAL", 10) // seconds
+	v.SetDefault("RATE_LIMIT_RPS", 1.0)
+	v.SetDefault("RATE_LIMIT_BURST", 5)
+	v.SetDefault("AUTO_MIGRATE", false)
+	v.SetDefault("LOG_FORMAT", "json")
+	v.SetDefault("LOG_LEVEL", "info")
+	v.SetDefault("TRACING_EXPORTER", "none")
+	v.SetDefault("TRACING_SAMPLE_RATIO", 1.0)
+	v.SetDefault("DELETED_USER_RETENTION_DAYS", 30)
+	v.SetDefault("PURGE_INTERVAL_MINUTES", 60)
+	v.SetDefault("SHUTDOWN_DRAIN_SECONDS", 5)
+	v.SetDefault("JWT_ISSUER", "golang-jwt-auth")
+	v.SetDefault("JWT_AUDIENCE", "golang-jwt-auth")
+	v.SetDefault("JWT_LEEWAY_SECONDS", 30)
+	v.SetDefault("ACCESS_TOKEN_TTL_MINUTES", 15)
+	v.SetDefault("REFRESH_TOKEN_TTL_HOURS", 168) // 7 days
+
+	// Unmarshal only sees keys viper knows about, so settings without a
+	// default must be bound explicitly to be read from the environment.
+	for _, key := range []string{"DATABASE_URL", "JWT_SECRET", "STORAGE_BACKEND", "OTEL_EXPORTER_OTLP_ENDPOINT", "DATABASE_REPLICA_URLS", "CORS_ALLOWED_ORIGINS"} {
+		if err := v.BindEnv(key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := readSecretFiles(v); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	// Without an explicit STORAGE_BACKEND the scheme of DATABASE_URL decides
+	if cfg.StorageBackend == "" {
+		cfg.StorageBackend = "postgres"
+		if strings.HasPrefix(cfg.DatabaseURL, "sqlite://") {
+			cfg.StorageBackend = "sqlite"
+		}
+	}
+
+	return cfg, v, nil
+}
+
+// readSecretFiles sets each of the secretKeys whose _FILE variant is set to
+// the contents of that file, without surrounding whitespace. Setting both a
+// key and its _FILE variant is an error.
+func readSecretFiles(v *viper.Viper) error {
+	for _, key := range secretKeys {
+		fileKey := key + "_FILE"
+		if err := v.BindEnv(fileKey); err != nil {
+			return err
+		}
+
+		path := v.GetString(fileKey)
+		if path == "" {
+			continue
+		}
+		if v.IsSet(key) {
+			return fmt.Errorf("only one of %s and %s may be set", key, fileKey)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", fileKey, err)
+		}
+		v.Set(key, strings.TrimSpace(string(data)))
+	}
+	return nil
 }
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+)
+
+// WriteRedacted writes every setting to w as KEY=value lines, in the format
+// of a .env file. JWT_SECRET is replaced by [REDACTED] and passwords in the
+// database URLs are masked.
+func (c *Config) WriteRedacted(w io.Writer) error {
+	val := reflect.ValueOf(c).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		key := val.Type().Field(i).Tag.Get("mapstructure")
+
+		value := fmt.Sprint(val.Field(i).Interface())
+		if list, ok := val.Field(i).Interface().([]string); ok {
+			value = strings.Join(list, ",")
+		}
+
+		if key == "JWT_SECRET" && value != "" {
+			value = logging.Redacted
+		} else {
+			value = logging.RedactString(value)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadableKeys are the settings Reload applies to the running server. Any
+// other setting is read once at startup, so a changed value is reported and
+// ignored until the next restart.
+var reloadableKeys = map[string]bool{
+	"LOG_LEVEL":              true,
+	"RATE_LIMIT_RPS":         true,
+	"RATE_LIMIT_BURST":       true,
+	"SHUTDOWN_DRAIN_SECONDS": true,
+	"CORS_ALLOWED_ORIGINS":   true,
+
+	"JWT_LEEWAY_SECONDS":       true,
+	"ACCESS_TOKEN_TTL_MINUTES": true,
+	"REFRESH_TOKEN_TTL_HOURS":  true,
+}
+
+var (
+	reloadMu    sync.Mutex
+	loadedFile  string       // configFile passed to LoadConfig
+	watcher     *viper.Viper // instance that read loadedFile, for WatchConfig
+	subscribers []func(previous, next *Config)
+)
+
+// Subscribe registers fn to be called with the previous and the new settings
+// after every reload that changes them. Subscribers run one at a time, in the
+// order they subscribed, and must not call Subscribe or Reload.
+func Subscribe(fn func(previous, next *Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+// Reload reads the settings again, from the same sources as LoadConfig. When
+// they are valid they replace the ones returned by Current and subscribers
+// are notified; otherwise the current settings are kept and an error is
+// returned. Settings that are not reloadable keep their current value.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	previous := current.Load()
+	if previous == nil {
+		return fmt.Errorf("configuration has not been loaded")
+	}
+
+	next, _, err := load(loadedFile)
+	if err != nil {
+		return err
+	}
+
+	if ignored := keepRestartOnly(previous, next); len(ignored) > 0 {
+		slog.Warn("ignoring changed settings that require a restart", "settings", ignored)
+	}
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	changed := changedKeys(previous, next)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	current.Store(next)
+	slog.Info("configuration reloaded", "settings", changed)
+	for _, fn := range subscribers {
+		fn(previous, next)
+	}
+	return nil
+}
+
+// watchDebounce is how long WatchConfig waits for a file to stop changing
+// before reloading it, so a file being rewritten is not read half written
+const watchDebounce = 250 * time.Millisecond
+
+// WatchConfig calls Reload whenever the file the settings were loaded from
+// changes. It does nothing when no file was read; environment variables are
+// only read again by calling Reload, such as on SIGHUP.
+func WatchConfig() {
+	reloadMu.Lock()
+	v := watcher
+	reloadMu.Unlock()
+
+	if v == nil || v.ConfigFileUsed() == "" {
+		return
+	}
+
+	var mu sync.Mutex
+	var timer *time.Timer
+	v.OnConfigChange(func(e fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(watchDebounce, func() {
+			if err := Reload(); err != nil {
+				slog.Error("failed to reload configuration", "file", e.Name, "error", err)
+			}
+		})
+	})
+	v.WatchConfig()
+}
+
+// keepRestartOnly copies every setting that is not reloadable from previous
+// to next, and returns the keys of those whose value differed
+func keepRestartOnly(previous, next *Config) []string {
+	var ignored []string
+	prev, nxt := reflect.ValueOf(previous).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < prev.NumField(); i++ {
+		key := prev.Type().Field(i).Tag.Get("mapstructure")
+		if reloadableKeys[key] {
+			continue
+		}
+		if !reflect.DeepEqual(prev.Field(i).Interface(), nxt.Field(i).Interface()) {
+			ignored = append(ignored, key)
+			nxt.Field(i).Set(prev.Field(i))
+		}
+	}
+	return ignored
+}
+
+// changedKeys returns the keys of the settings that differ between a and b
+func changedKeys(a, b *Config) []string {
+	var changed []string
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
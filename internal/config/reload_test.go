@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "jwt_secret: "+testSecret+"\nstorage_backend: memory\nrate_limit_rps: 2\nserver_port: 8080\n")
+	if err := loadTestConfig(t, path); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	t.Cleanup(func() { subscribers = nil })
+
+	var notified []*Config
+	Subscribe(func(previous, next *Config) {
+		if previous.RateLimitRPS != 2 {
+			t.Errorf("expected the previous settings, got rate %v", previous.RateLimitRPS)
+		}
+		notified = append(notified, next)
+	})
+	initial := Current()
+
+	// Unchanged settings notify nobody
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(notified) != 0 {
+		t.Fatalf("expected no notification, got %d", len(notified))
+	}
+
+	if err := os.WriteFile(path, []byte("jwt_secret: "+testSecret+"\nstorage_backend: memory\nrate_limit_rps: 5\nserver_port: 9090\ncors_allowed_origins: https://a.example.com,https://b.example.com\n"), 0o600); err != nil {
+		t.Fatalf("failed to rewrite config: %v", err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(notified) != 1 || notified[0] != Current() {
+		t.Fatalf("expected one notification with the new settings, got %d", len(notified))
+	}
+	if Current().RateLimitRPS != 5 {
+		t.Errorf("expected the reloaded rate 5, got %v", Current().RateLimitRPS)
+	}
+	if origins := Current().CORSAllowedOrigins; len(origins) != 2 || origins[1] != "https://b.example.com" {
+		t.Errorf("expected the reloaded CORS origins, got %v", origins)
+	}
+	if Current().ServerPort != "8080" {
+		t.Errorf("expected the restart-only port to be kept, got %q", Current().ServerPort)
+	}
+	if initial.RateLimitRPS != 2 {
+		t.Errorf("expected the previous snapshot to be unchanged, got rate %v", initial.RateLimitRPS)
+	}
+
+	// Invalid settings are rejected and the current ones kept
+	if err := os.WriteFile(path, []byte("jwt_secret: "+testSecret+"\nstorage_backend: memory\nrate_limit_rps: 0\n"), 0o600); err != nil {
+		t.Fatalf("failed to rewrite config: %v", err)
+	}
+	if err := Reload(); err == nil {
+		t.Error("expected an error for an invalid rate limit")
+	}
+	if Current().RateLimitRPS != 5 || len(notified) != 1 {
+		t.Errorf("expected the invalid settings to be ignored, got rate %v", Current().RateLimitRPS)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaConnectTimeout bounds the first ping of a read replica in InitDB,
+// which does not retry, so a missing replica does not hold up startup
+const replicaConnectTimeout = 5 * time.Second
+
+// replica is the pool of one read replica and whether its last ping
+// succeeded
+type replica struct {
+	index   int // position in Config.DatabaseReplicaURLs, for logs
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// setHealth records the result of a ping and logs transitions
+func (r *replica) setHealth(err error) {
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	if healthy {
+		slog.Info("read replica is reachable", "replica", r.index)
+	} else {
+		slog.Error("read replica became unreachable", "replica", r.index, "error", err)
+	}
+}
+
+// ReadPool returns the pool for queries that tolerate replication lag: the
+// next healthy read replica in round-robin order, or the primary's pool when
+// no replica is configured or healthy. Reads that must see the caller's own
+// writes use GetPool.
+func (db *DbConnect) ReadPool() *pgxpool.Pool {
+	if n := uint64(len(db.replicas)); n > 0 {
+		start := db.next.Add(1)
+		for i := uint64(0); i < n; i++ {
+			if r := db.replicas[(start+i)%n]; r.healthy.Load() {
+				return r.pool
+			}
+		}
+	}
+	return db.GetPool()
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+)
+
+// MinJWTSecretLength is the shortest JWT_SECRET accepted, in bytes. HS256
+// keys should be at least as long as the hash, 256 bits.
+const MinJWTSecretLength = 32
+
+// Validate reports every setting that is missing or out of range, so the
+// server refuses to start instead of failing on the first request that needs
+// it
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.JWTSecret != "", "JWT_SECRET is not set")
+	check(c.JWTSecret == "" || len(c.JWTSecret) >= MinJWTSecretLength, "JWT_SECRET must be at least %d bytes long, got %d", MinJWTSecretLength, len(c.JWTSecret))
+
+	check(c.JWTIssuer != "", "JWT_ISSUER is not set")
+	check(c.JWTAudience != "", "JWT_AUDIENCE is not set")
+	check(c.JWTLeewaySeconds >= 0, "JWT_LEEWAY_SECONDS must not be negative, got %d", c.JWTLeewaySeconds)
+	check(c.AccessTokenTTLMinutes >= 1, "ACCESS_TOKEN_TTL_MINUTES must be at least 1, got %d", c.AccessTokenTTLMinutes)
+	check(c.RefreshTokenTTLHours >= 1, "REFRESH_TOKEN_TTL_HOURS must be at least 1, got %d", c.RefreshTokenTTLHours)
+
+	port, err := strconv.Atoi(c.ServerPort)
+	check(err == nil && port >= 1 && port <= 65535, "SERVER_PORT must be a port number between 1 and 65535, got %q", c.ServerPort)
+
+	switch c.StorageBackend {
+	case "postgres", "sqlite":
+		check(c.DatabaseURL != "", "DATABASE_URL is not set, but STORAGE_BACKEND is %s", c.StorageBackend)
+	case "memory":
+	default:
+		check(false, "STORAGE_BACKEND must be postgres, sqlite or memory, got %q", c.StorageBackend)
+	}
+
+	check(c.MaxConns >= 1, "DB_MAX_CONNS must be at least 1, got %d", c.MaxConns)
+	check(c.MinConns >= 0, "DB_MIN_CONNS must not be negative, got %d", c.MinConns)
+	check(c.MinConns <= c.MaxConns, "DB_MIN_CONNS (%d) must not exceed DB_MAX_CONNS (%d)", c.MinConns, c.MaxConns)
+	check(c.MaxConnLifetime >= 0, "DB_MAX_CONN_LIFETIME must not be negative, got %d", c.MaxConnLifetime)
+	check(c.DBConnectAttempts >= 1, "DB_CONNECT_ATTEMPTS must be at least 1, got %d", c.DBConnectAttempts)
+	check(c.DBHealthCheckInterval >= 1, "DB_HEALTH_CHECK_INTERVAL must be at least 1 second, got %d", c.DBHealthCheckInterval)
+
+	check(c.RateLimitRPS > 0, "RATE_LIMIT_RPS must be positive, got %v", c.RateLimitRPS)
+	check(c.RateLimitBurst > 0, "RATE_LIMIT_BURST must be positive, got %d", c.RateLimitBurst)
+
+	_, err = logging.ParseLevel(c.LogLevel)
+	check(err == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	format := strings.ToLower(c.LogFormat)
+	check(format == logging.FormatJSON || format == logging.FormatText, "LOG_FORMAT must be json or text, got %q", c.LogFormat)
+
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", c.TracingSampleRatio)
+
+	for _, origin := range c.CORSAllowedOrigins {
+		check(origin == "*" || isOrigin(origin), "CORS_ALLOWED_ORIGINS must hold * or origins such as https://app.example.com, got %q", origin)
+	}
+
+	check(c.DeletedUserRetentionDays >= 0, "DELETED_USER_RETENTION_DAYS must not be negative, got %d", c.DeletedUserRetentionDays)
+	check(c.DeletedUserRetentionDays == 0 || c.PurgeIntervalMinutes >= 1, "PURGE_INTERVAL_MINUTES must be at least 1, got %d", c.PurgeIntervalMinutes)
+	check(c.ShutdownDrainSeconds >= 0, "SHUTDOWN_DRAIN_SECONDS must not be negative, got %d", c.ShutdownDrainSeconds)
+
+	return errors.Join(errs...)
+}
+
+// isOrigin reports whether s is an http or https origin: a scheme and host,
+// with an optional port but no path
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
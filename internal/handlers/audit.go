@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
+)
+
+type AuditDBInterface interface {
+	AppendAuditEvent(ctx context.Context, event *audit.Event) error
+	ListAuditEvents(ctx context.Context, filter audit.Filter) (*audit.Page, error)
+}
+
+type AuditHandler struct {
+	dbImpl AuditDBInterface
+	logger *slog.Logger
+}
+
+// NewAuditHandler returns an AuditHandler logging to logger, or to the
+// default logger when it is nil
+func NewAuditHandler(db AuditDBInterface, logger *slog.Logger) *AuditHandler {
+	return &AuditHandler{dbImpl: db, logger: logging.OrDefault(logger)}
+}
+
+// AuditEventListResponse is the envelope returned by GET /audit-events
+type AuditEventListResponse struct {
+	Data       []*audit.Event `json:"data"`
+	NextCursor *string        `json:"next_cursor"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// ListAuditEvents handles
+// GET /audit-events?actor_id=&target_id=&action=&since=&until=&limit=&cursor=,
+// newest first
+func (h *AuditHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, err.Error()))
+		return
+	}
+
+	page, err := h.dbImpl.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	resp := AuditEventListResponse{Data: page.Events, HasMore: page.HasMore}
+	if page.NextCursor != "" {
+		resp.NextCursor = &page.NextCursor
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseAuditFilter reads the filter and pagination query parameters of
+// GET /audit-events. Limits above audit.MaxPageSize are clamped.
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{Action: query.Get("action")}
+
+	if filter.Action != "" && !audit.IsValidAction(filter.Action) {
+		return filter, fmt.Errorf("invalid action %q", filter.Action)
+	}
+
+	var err error
+	for _, param := range []struct {
+		name string
+		dest *int64
+	}{{"actor_id", &filter.ActorID}, {"target_id", &filter.TargetID}} {
+		if value := query.Get(param.name); value != "" {
+			*param.dest, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || *param.dest < 1 {
+				return filter, fmt.Errorf("invalid %s: must be a positive integer", param.name)
+			}
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if value := query.Get(param.name); value != "" {
+			*param.dest, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", param.name)
+			}
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 {
+			return filter, fmt.Errorf("invalid limit: must be a positive integer")
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.BeforeID, err = audit.DecodeCursor(cursor)
+		if err != nil {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	return filter, nil
+}
+
+// AuditChainResponse is the result of GET /audit-events/verify. BrokenAt and
+// Reason are only set when the chain is broken.
+type AuditChainResponse struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyAuditChain handles GET /audit-events/verify by recomputing the hash
+// chain over the whole log
+func (h *AuditHandler) VerifyAuditChain(w http.ResponseWriter, r *http.Request) {
+	checked, err := audit.Verify(r.Context(), h.dbImpl)
+
+	var chainErr *audit.ChainError
+	switch {
+	case errors.As(err, &chainErr):
+		h.logger.ErrorContext(r.Context(), "audit chain broken", "event_id", chainErr.EventID, "reason", chainErr.Reason)
+		json.NewEncoder(w).Encode(AuditChainResponse{Checked: checked, BrokenAt: &chainErr.EventID, Reason: chainErr.Reason})
+	case err != nil:
+		utils.WriteProblem(w, r, err)
+	default:
+		json.NewEncoder(w).Encode(AuditChainResponse{Valid: true, Checked: checked})
+	}
+}
+
+// newAuditEvent returns an event for action on the user targetID, made by the
+// authenticated caller of r if there is one
+func newAuditEvent(r *http.Request, action string, targetID int64) *audit.Event {
+	event := audit.NewEvent(r, action)
+	event.TargetID = targetID
+	if claims, ok := utils.AuthClaimsFromContext(r.Context()); ok {
+		event.ActorID = claims.UserID
+	}
+	return event
+}
+
+// auditAppender is the part of the handlers' database interfaces that
+// records audit events
+type auditAppender interface {
+	AppendAuditEvent(ctx context.Context, event *audit.Event) error
+}
+
+// recordAuditEvent appends event on its own, for requests that failed and
+// so have no transaction to record it in. A failure to record is logged
+// rather than changing the response.
+func recordAuditEvent(r *http.Request, logger *slog.Logger, store auditAppender, event *audit.Event) {
+	if err := store.AppendAuditEvent(r.Context(), event); err != nil {
+		logger.ErrorContext(r.Context(), "failed to record audit event", "action", event.Action, "error", err)
+	}
+}
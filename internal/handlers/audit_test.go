@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditEvents(t *testing.T) {
+	store := models.NewMemoryStore()
+	admin := &models.User{FirstName: "Admin", LastName: "User", PhoneNumber: "+15550002001", Email: "audit-admin@example.com", Password: "password123", Role: models.RoleAdmin}
+	assert.NoError(t, store.RegisterUser(context.Background(), admin))
+
+	authHandler := NewAuthHandler(store, nil)
+	post := func(handler http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/auth", bytes.NewBuffer(raw))
+		req.Header.Set("User-Agent", "audit-test")
+		req.Header.Set(audit.RequestIDHeader, "req-1")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := post(authHandler.Register, RegisterRequest{FirstName: "New", LastName: "User", Email: "audit-user@example.com", Password: "password123", PhoneNumber: "+15550002002"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	user, err := store.GetUserByEmail(context.Background(), "audit-user@example.com")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, post(authHandler.Login, LoginRequest{Email: "audit-user@example.com", Password: "wrong-password1"}).Code)
+	assert.Equal(t, http.StatusOK, post(authHandler.Login, LoginRequest{Email: "audit-user@example.com", Password: "password123"}).Code)
+
+	userHandler := NewUserHandler(store, nil)
+	auditHandler := NewAuditHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", userHandler.PatchUser).Methods("PATCH")
+	router.HandleFunc("/audit-events", auditHandler.ListAuditEvents).Methods("GET")
+	router.HandleFunc("/audit-events/verify", auditHandler.VerifyAuditChain).Methods("GET")
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, admin.ID, models.RoleAdmin))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("PATCH", fmt.Sprintf("/users/%d", user.ID), `{"first_name":"Renamed"}`).Code)
+
+	list := func(query string) AuditEventListResponse {
+		w := send("GET", "/audit-events"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var resp AuditEventListResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := list("")
+	actions := []string{}
+	for _, event := range resp.Data {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{audit.ActionUserUpdate, audit.ActionLogin, audit.ActionLoginFailed, audit.ActionRegister}, actions)
+
+	update := resp.Data[0]
+	assert.Equal(t, admin.ID, update.ActorID)
+	assert.Equal(t, user.ID, update.TargetID)
+	assert.JSONEq(t, `{"first_name":{"old":"New","new":"Renamed"}}`, string(update.Diff))
+
+	failed := resp.Data[2]
+	assert.Equal(t, int64(0), failed.ActorID)
+	assert.Equal(t, user.ID, failed.TargetID)
+	assert.Equal(t, "audit-test", failed.UserAgent)
+	assert.Equal(t, "req-1", failed.RequestID)
+
+	// The registration diff never contains the password
+	assert.NotContains(t, string(resp.Data[3].Diff), "password")
+
+	resp = list(fmt.Sprintf("?actor_id=%d", user.ID))
+	assert.Len(t, resp.Data, 2)
+	resp = list("?action=" + audit.ActionLoginFailed)
+	assert.Len(t, resp.Data, 1)
+
+	resp = list("?limit=3")
+	assert.Len(t, resp.Data, 3)
+	assert.True(t, resp.HasMore)
+	if assert.NotNil(t, resp.NextCursor) {
+		resp = list("?limit=3&cursor=" + *resp.NextCursor)
+		assert.Len(t, resp.Data, 1)
+		assert.Equal(t, audit.ActionRegister, resp.Data[0].Action)
+		assert.Nil(t, resp.NextCursor)
+	}
+
+	for _, query := range []string{"?action=unknown", "?actor_id=abc", "?since=yesterday", "?limit=0", "?cursor=!!"} {
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/audit-events"+query, "").Code, query)
+	}
+
+	w = send("GET", "/audit-events/verify", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"valid":true,"checked":4}`, w.Body.String())
+}
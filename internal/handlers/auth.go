@@ -1,31 +1,36 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
-	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/metrics"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthDBInterface interface {
-	RegisterUser(user *models.User) error
-	GetUserByEmail(email string) (*models.User, error)
-	CreateRefreshToken(refreshToken *models.RefreshToken) error
-	GetRefreshToken(userID int64) (*models.RefreshToken, error)
-	DeleteRefreshToken(userID int64) error
+	RegisterUser(ctx context.Context, user *models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, userID int64) (*models.RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, userID int64) error
+	AppendAuditEvent(ctx context.Context, event *audit.Event) error
+	WithTx(ctx context.Context, fn func(tx models.Store) error) error
 }
 
 // LoginRequest represents the login request payload
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 // LoginResponse represents the login response payload
@@ -34,40 +39,53 @@ type LoginResponse struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
-// Claims represents the JWT claims
-type Claims struct {
-	UserID int `json:"user_id"`
-	jwt.RegisteredClaims
-}
+// Claims represents the JWT claims of the access tokens issued by Login and
+// RefreshToken
+type Claims = utils.TokenClaims
 
 type AuthHandler struct {
 	dbImpl AuthDBInterface
+	logger *slog.Logger
 }
 
-func NewAuthHandler(user *models.User) *AuthHandler {
-	return &AuthHandler{dbImpl: user}
+// NewAuthHandler returns an AuthHandler logging to logger, or to the default
+// logger when it is nil
+func NewAuthHandler(db AuthDBInterface, logger *slog.Logger) *AuthHandler {
+	return &AuthHandler{dbImpl: db, logger: logging.OrDefault(logger)}
 }
 
 // Register handles POST /auth/register
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var user models.User
+	var req RegisterRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusInternalServerError)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteProblem(w, r, errInvalidPayload)
 		return
 	}
 
-	// Validate the user struct
-	if validationErrors := utils.ValidateStruct(user); validationErrors != nil {
-		http.Error(w, "Validation failed: "+strings.Join(validationErrors, ", "), http.StatusBadRequest)
+	// Validate the request
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		utils.WriteProblem(w, r, validationErrors)
 		return
 	}
 
-	err := h.dbImpl.RegisterUser(&user)
+	user := req.toUser()
+	err := h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if err := tx.RegisterUser(r.Context(), user); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, audit.ActionRegister, user.ID)
+		event.ActorID = user.ID
+		diff, err := userAuditDiff(nil, user)
+		if err != nil {
+			return err
+		}
+		event.Diff = diff
+		return tx.AppendAuditEvent(r.Context(), event)
+	})
 	if err != nil {
-		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
@@ -80,53 +98,82 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 // Login handles POST /auth/login
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var req LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidPayload)
 		return
 	}
 
-	user, err := h.dbImpl.GetUserByEmail(req.Email)
-	if err != nil || user == nil {
-		fmt.Println(err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		utils.WriteProblem(w, r, validationErrors)
+		return
+	}
+
+	// Unknown emails and wrong passwords get the same answer, so the response
+	// does not reveal which accounts exist
+	user, err := h.dbImpl.GetUserByEmail(r.Context(), req.Email)
+	if errors.Is(err, models.ErrNotFound) {
+		h.logger.InfoContext(r.Context(), "login failed", "reason", "unknown email")
+		metrics.LoginsTotal.WithLabelValues(metrics.ResultFailed, metrics.ReasonUnknownEmail).Inc()
+		recordAuditEvent(r, h.logger, h.dbImpl, newAuditEvent(r, audit.ActionLoginFailed, 0))
+		utils.WriteProblem(w, r, errInvalidCredentials)
+		return
+	}
+	if err != nil {
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	err = tracing.CompareHashAndPassword(r.Context(), []byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		h.logger.InfoContext(r.Context(), "login failed", "reason", "wrong password", "target_user_id", user.ID)
+		metrics.LoginsTotal.WithLabelValues(metrics.ResultFailed, metrics.ReasonWrongPassword).Inc()
+		recordAuditEvent(r, h.logger, h.dbImpl, newAuditEvent(r, audit.ActionLoginFailed, user.ID))
+		utils.WriteProblem(w, r, errInvalidCredentials)
 		return
 	}
 
-	accessToken, err := utils.GenerateAccessToken(user.ID)
+	// Checked after the password, so the status is only revealed to the owner
+	if problem := accountSuspended(user); problem != nil {
+		h.logger.InfoContext(r.Context(), "login failed", "reason", "account "+user.Status, "target_user_id", user.ID)
+		metrics.LoginsTotal.WithLabelValues(metrics.ResultFailed, metrics.ReasonAccountSuspended).Inc()
+		recordAuditEvent(r, h.logger, h.dbImpl, newAuditEvent(r, audit.ActionLoginFailed, user.ID))
+		utils.WriteProblem(w, r, problem)
+		return
+	}
+
+	accessToken, err := utils.GenerateAccessToken(user.ID, user.Role)
 	if err != nil {
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, fmt.Errorf("failed to generate access token: %w", err))
 		return
 	}
 
 	rawSecureToken, err := utils.GenerateSecureToken(32)
 	if err != nil {
-		http.Error(w, "Secure token generation error", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, fmt.Errorf("failed to generate refresh token: %w", err))
 		return
 	}
 
-	hashSecureToken, _ := utils.HashToken(rawSecureToken)
+	hashSecureToken, _ := utils.HashToken(r.Context(), rawSecureToken)
 	refreshToken := &models.RefreshToken{
 		UserID:    user.ID,
 		Token:     hashSecureToken,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: time.Now().Add(utils.CurrentTokenSettings().RefreshTTL),
 		CreatedAt: time.Now(),
 	}
 
-	err = h.dbImpl.CreateRefreshToken(refreshToken)
+	err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if err := tx.CreateRefreshToken(r.Context(), refreshToken); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, audit.ActionLogin, user.ID)
+		event.ActorID = user.ID
+		return tx.AppendAuditEvent(r.Context(), event)
+	})
 	if err != nil {
-		fmt.Printf("Error creating refresh token: %v\n", err)
-		http.Error(w, "Failed to create refresh token", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
@@ -138,9 +185,26 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: rawSecureToken,
 	}
 
+	metrics.LoginsTotal.WithLabelValues(metrics.ResultSucceeded, "").Inc()
 	json.NewEncoder(w).Encode(resp)
 }
 
+var (
+	errInvalidPayload      = utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "The request body is not valid JSON.")
+	errInvalidCredentials  = utils.NewProblem(http.StatusUnauthorized, utils.CodeInvalidCredentials, "Invalid email or password.")
+	errInvalidRefreshToken = utils.NewProblem(http.StatusUnauthorized, utils.CodeInvalidToken, "Invalid refresh token.")
+	errExpiredRefreshToken = utils.NewProblem(http.StatusUnauthorized, utils.CodeExpiredToken, "Expired refresh token.")
+)
+
+// accountSuspended returns the problem for a user who may not authenticate
+// because of their status, or nil if the user is active
+func accountSuspended(user *models.User) *utils.Problem {
+	if user.Status == models.StatusActive {
+		return nil
+	}
+	return utils.NewProblem(http.StatusForbidden, utils.CodeAccountSuspended, "This account is "+user.Status+".")
+}
+
 type RefreshRequest struct {
 	UserID       int64  `json:"user_id"`
 	RefreshToken string `json:"refresh_token"`
@@ -150,40 +214,115 @@ type RefreshRequest struct {
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req RefreshRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidPayload)
 		return
 	}
 
-	refreshToken, err := h.dbImpl.GetRefreshToken(req.UserID)
+	// Hash the replacement token up front to keep the transaction short
+	rawSecureToken, err := utils.GenerateSecureToken(32)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		utils.WriteProblem(w, r, fmt.Errorf("failed to generate refresh token: %w", err))
 		return
 	}
-
-	err = utils.ValidateRefreshToken(refreshToken)
+	hashSecureToken, err := utils.HashToken(r.Context(), rawSecureToken)
 	if err != nil {
-		http.Error(w, "Expired refresh token", http.StatusUnauthorized)
+		utils.WriteProblem(w, r, fmt.Errorf("failed to hash refresh token: %w", err))
 		return
 	}
 
-	if utils.CompareToken(refreshToken.Token, req.RefreshToken) != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Check the presented token before the transaction, as comparing it with
+	// bcrypt is slow and must not be repeated when the transaction is retried
+	presented, err := h.checkRefreshToken(r.Context(), req)
+
+	// Replace the checked token with the new one atomically, so a refresh
+	// token can only ever be exchanged once.
+	var user *models.User
+	if err == nil {
+		err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+			// The token may have been exchanged or revoked since it was checked
+			refreshToken, err := tx.GetRefreshToken(r.Context(), req.UserID)
+			if errors.Is(err, models.ErrNotFound) {
+				return errInvalidRefreshToken
+			}
+			if err != nil {
+				return err
+			}
+			if refreshToken.Token != presented.Token {
+				return errInvalidRefreshToken
+			}
+
+			// The access token carries the user's current role
+			if user, err = tx.GetUserByID(r.Context(), req.UserID); err != nil {
+				return err
+			}
+			if problem := accountSuspended(user); problem != nil {
+				return problem
+			}
+
+			if err := tx.DeleteRefreshToken(r.Context(), req.UserID); err != nil {
+				return err
+			}
+
+			err = tx.CreateRefreshToken(r.Context(), &models.RefreshToken{
+				UserID:    req.UserID,
+				Token:     hashSecureToken,
+				ExpiresAt: time.Now().Add(utils.CurrentTokenSettings().RefreshTTL),
+				CreatedAt: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+
+			event := newAuditEvent(r, audit.ActionRefresh, req.UserID)
+			event.ActorID = req.UserID
+			return tx.AppendAuditEvent(r.Context(), event)
+		})
+	}
+	if err != nil {
+		// Any transaction was rolled back, so the failure is recorded on its own
+		recordAuditEvent(r, h.logger, h.dbImpl, newAuditEvent(r, audit.ActionRefreshFailed, req.UserID))
+		metrics.TokenRefreshesTotal.WithLabelValues(metrics.ResultFailed, utils.ProblemFromError(err).Code).Inc()
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	accessToken, err := utils.GenerateAccessToken(req.UserID)
+	accessToken, err := utils.GenerateAccessToken(user.ID, user.Role)
 	if err != nil {
-		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
+		utils.WriteProblem(w, r, fmt.Errorf("failed to generate access token: %w", err))
 		return
 	}
 
-	// TODO: Optionally rotate refresh token here and update expire_at
-	// response with new refresh token
-	json.NewEncoder(w).Encode(map[string]string{
-		"access_token": accessToken,
+	metrics.TokenRefreshesTotal.WithLabelValues(metrics.ResultSucceeded, "").Inc()
+	json.NewEncoder(w).Encode(LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: rawSecureToken,
 	})
 }
 
+// checkRefreshToken returns the stored refresh token of req.UserID if it has
+// not expired and req.RefreshToken matches it. A mismatch is counted as
+// possible token reuse.
+func (h *AuthHandler) checkRefreshToken(ctx context.Context, req RefreshRequest) (*models.RefreshToken, error) {
+	refreshToken, err := h.dbImpl.GetRefreshToken(ctx, req.UserID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if utils.ValidateRefreshToken(refreshToken) != nil {
+		return nil, errExpiredRefreshToken
+	}
+
+	if utils.CompareToken(ctx, refreshToken.Token, req.RefreshToken) != nil {
+		metrics.RefreshTokenReuseTotal.Inc()
+		return nil, errInvalidRefreshToken
+	}
+
+	return refreshToken, nil
+}
+
 // Logout handles POST /auth/logout
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	// For logout, typically the client deletes the tokens.
@@ -195,13 +334,18 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 
 	var req LogoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidPayload)
 		return
 	}
 
-	err := h.dbImpl.DeleteRefreshToken(req.UserID)
+	err := h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if err := tx.DeleteRefreshToken(r.Context(), req.UserID); err != nil {
+			return err
+		}
+		return tx.AppendAuditEvent(r.Context(), newAuditEvent(r, audit.ActionLogout, req.UserID))
+	})
 	if err != nil {
-		http.Error(w, "Failed to logout: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
@@ -2,29 +2,45 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/metrics"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/mocks"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// auditAction matches an audit event with the given action in mock
+// expectations
+func auditAction(action string) any {
+	return mock.MatchedBy(func(event *audit.Event) bool { return event.Action == action })
+}
+
 func TestRegister(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewAuthHandler(nil)
+	handler := NewAuthHandler(nil, nil)
 	handler.dbImpl = mockDB
 
-	user := &models.User{FirstName: "New", LastName: "User", Email: "new@example.com", Password: "password123", Status: "active", PhoneNumber: "+1234567890"}
+	registerReq := RegisterRequest{FirstName: "New", LastName: "User", Email: "new@example.com", Password: "password123", PhoneNumber: "+1234567890"}
+	user := &models.User{FirstName: "New", LastName: "User", Email: "new@example.com", Password: "password123", Status: "active", Role: models.RoleUser, PhoneNumber: "+1234567890"}
 
+	jsonBody, _ := json.Marshal(registerReq)
 	mockDB.On("RegisterUser", user).Return(nil)
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionRegister)).Return(nil)
 
-	jsonBody, _ := json.Marshal(user)
 	req := httptest.NewRequest("POST", "/users", bytes.NewBuffer(jsonBody))
 	w := httptest.NewRecorder()
 
@@ -34,9 +50,64 @@ func TestRegister(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestRegisterIgnoresInternalFields(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewAuthHandler(mockDB, nil)
+
+	// Internal fields in the body are ignored
+	body := map[string]any{"first_name": "New", "last_name": "User", "email": "new@example.com", "password": "password123", "phone_number": "+1234567890",
+		"role": models.RoleAdmin, "status": models.StatusBanned, "id": 42, "password_hash": "hash"}
+
+	mockDB.On("RegisterUser", mock.MatchedBy(func(u *models.User) bool {
+		return u.Role == models.RoleUser && u.Status == models.StatusActive && u.ID == 0 && u.PasswordHash == ""
+	})).Return(nil)
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionRegister)).Return(nil)
+
+	jsonBody, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	handler.Register(w, httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(jsonBody)))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockDB.AssertExpectations(t)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	handler := NewAuthHandler(models.NewMemoryStore(), nil)
+
+	tests := []struct {
+		body  string
+		field string
+		rule  string
+	}{
+		{`{"first_name":"New","last_name":"User","email":"new@example.com","password":"short","phone_number":"+15551234567"}`, "password", "password"},
+		{`{"first_name":"New","last_name":"User","email":"not-an-email","password":"password123","phone_number":"+15551234567"}`, "email", "email"},
+		{`{"last_name":"User","email":"new@example.com","password":"password123","phone_number":"+15551234567"}`, "first_name", "required"},
+		{`{"first_name":"New","last_name":"User","email":"new@example.com","password":"password123","phone_number":"5551234567"}`, "phone_number", "phone"},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		handler.Register(w, httptest.NewRequest("POST", "/auth/register", strings.NewReader(tc.body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, tc.body)
+
+		assert.Equal(t, utils.ProblemContentType, w.Header().Get("Content-Type"))
+		var resp utils.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), tc.body)
+		assert.Equal(t, utils.CodeValidationFailed, resp.Code)
+		if assert.Len(t, resp.Errors, 1, tc.body) {
+			assert.Equal(t, tc.field, resp.Errors[0].Field)
+			assert.Equal(t, tc.rule, resp.Errors[0].Rule)
+			assert.NotEmpty(t, resp.Errors[0].Message)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.Register(w, httptest.NewRequest("POST", "/auth/register", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestLogin(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewAuthHandler(nil)
+	handler := NewAuthHandler(nil, nil)
 	handler.dbImpl = mockDB
 
 	// Mock user data
@@ -46,11 +117,13 @@ func TestLogin(t *testing.T) {
 		ID:           1,
 		Email:        "test@example.com",
 		PasswordHash: string(hashedPassword),
+		Status:       models.StatusActive,
 	}
 
 	loginReq := LoginRequest{Email: "test@example.com", Password: password}
 	mockDB.On("GetUserByEmail", loginReq.Email).Return(user, nil).Once()
 	mockDB.On("CreateRefreshToken", mock.AnythingOfType("*models.RefreshToken")).Return(nil).Once()
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionLogin)).Return(nil).Once()
 
 	jsonBody, _ := json.Marshal(loginReq)
 	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
@@ -68,7 +141,7 @@ func TestLogin(t *testing.T) {
 
 func TestRefreshToken(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewAuthHandler(nil)
+	handler := NewAuthHandler(nil, nil)
 	handler.dbImpl = mockDB
 
 	// Mock refresh token data
@@ -81,7 +154,12 @@ func TestRefreshToken(t *testing.T) {
 	}
 
 	refreshReq := RefreshRequest{UserID: 1, RefreshToken: rawToken}
-	mockDB.On("GetRefreshToken", refreshReq.UserID).Return(refreshToken, nil).Once()
+	// Read once to check the token and again inside the transaction
+	mockDB.On("GetRefreshToken", refreshReq.UserID).Return(refreshToken, nil).Twice()
+	mockDB.On("GetUserByID", refreshReq.UserID).Return(&models.User{ID: 1, Status: models.StatusActive, Role: models.RoleUser}, nil).Once()
+	mockDB.On("DeleteRefreshToken", refreshReq.UserID).Return(nil).Once()
+	mockDB.On("CreateRefreshToken", mock.AnythingOfType("*models.RefreshToken")).Return(nil).Once()
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionRefresh)).Return(nil).Once()
 
 	jsonBody, _ := json.Marshal(refreshReq)
 	req := httptest.NewRequest("POST", "/token/refresh", bytes.NewBuffer(jsonBody))
@@ -93,5 +171,174 @@ func TestRefreshToken(t *testing.T) {
 	var resp map[string]string
 	json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.NotEmpty(t, resp["access_token"])
+	assert.NotEmpty(t, resp["refresh_token"])
+	assert.NotEqual(t, rawToken, resp["refresh_token"])
+	mockDB.AssertExpectations(t)
+}
+
+func TestRefreshTokenRotatedConcurrently(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewAuthHandler(mockDB, nil)
+
+	rawToken := "raw_refresh_token"
+	hashedToken, _ := bcrypt.GenerateFromPassword([]byte(rawToken), bcrypt.MinCost)
+	checked := &models.RefreshToken{UserID: 1, Token: string(hashedToken), ExpiresAt: time.Now().Add(time.Hour)}
+	rotated := &models.RefreshToken{UserID: 1, Token: "rotated", ExpiresAt: time.Now().Add(time.Hour)}
+
+	// Another refresh replaces the token after it was checked
+	mockDB.On("GetRefreshToken", int64(1)).Return(checked, nil).Once()
+	mockDB.On("GetRefreshToken", int64(1)).Return(rotated, nil).Once()
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionRefreshFailed)).Return(nil).Once()
+
+	reuse := testutil.ToFloat64(metrics.RefreshTokenReuseTotal)
+	jsonBody, _ := json.Marshal(RefreshRequest{UserID: 1, RefreshToken: rawToken})
+	w := httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(jsonBody)))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, reuse, testutil.ToFloat64(metrics.RefreshTokenReuseTotal))
+	mockDB.AssertNotCalled(t, "DeleteRefreshToken", int64(1))
+	mockDB.AssertExpectations(t)
+}
+
+func TestRefreshTokenReuseCountedOnce(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewAuthHandler(mockDB, nil)
+
+	hashedToken, _ := bcrypt.GenerateFromPassword([]byte("current"), bcrypt.MinCost)
+	mockDB.On("GetRefreshToken", int64(1)).Return(&models.RefreshToken{UserID: 1, Token: string(hashedToken), ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionRefreshFailed)).Return(nil).Once()
+
+	reuse := testutil.ToFloat64(metrics.RefreshTokenReuseTotal)
+	jsonBody, _ := json.Marshal(RefreshRequest{UserID: 1, RefreshToken: "stolen"})
+	w := httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(jsonBody)))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, reuse+1, testutil.ToFloat64(metrics.RefreshTokenReuseTotal))
+	mockDB.AssertExpectations(t)
+}
+
+func TestAuthFlowWithMemoryStore(t *testing.T) {
+	handler := NewAuthHandler(models.NewMemoryStore(), nil)
+
+	user := RegisterRequest{FirstName: "Memory", LastName: "User", Email: "memory@example.com", Password: "password123", PhoneNumber: "+1234567890"}
+	jsonBody, _ := json.Marshal(user)
+	w := httptest.NewRecorder()
+	handler.Register(w, httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	jsonBody, _ = json.Marshal(LoginRequest{Email: user.Email, Password: user.Password})
+	w = httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loginResp LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &loginResp)
+	assert.NotEmpty(t, loginResp.RefreshToken)
+
+	jsonBody, _ = json.Marshal(RefreshRequest{UserID: 1, RefreshToken: loginResp.RefreshToken})
+	w = httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refreshResp LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshResp)
+	assert.NotEmpty(t, refreshResp.RefreshToken)
+
+	// The rotated token can no longer be exchanged
+	w = httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	jsonBody, _ = json.Marshal(map[string]int64{"user_id": 1})
+	w = httptest.NewRecorder()
+	handler.Logout(w, httptest.NewRequest("POST", "/auth/logout", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	jsonBody, _ = json.Marshal(RefreshRequest{UserID: 1, RefreshToken: refreshResp.RefreshToken})
+	w = httptest.NewRecorder()
+	handler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLoginRejectsDeletedUser(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := &models.User{FirstName: "Deleted", LastName: "User", Email: "deleted@example.com", Password: "password123", PhoneNumber: "+1234567891"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+	assert.NoError(t, store.DeleteUser(context.Background(), user.ID))
+
+	failures := metrics.LoginsTotal.WithLabelValues(metrics.ResultFailed, metrics.ReasonUnknownEmail)
+	before := testutil.ToFloat64(failures)
+
+	jsonBody, _ := json.Marshal(LoginRequest{Email: user.Email, Password: user.Password})
+	w := httptest.NewRecorder()
+	NewAuthHandler(store, nil).Login(w, httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(jsonBody)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+}
+
+func TestAuthErrorsAreProblems(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewAuthHandler(nil, nil)
+	handler.dbImpl = mockDB
+
+	mockDB.On("RegisterUser", mock.AnythingOfType("*models.User")).Return(errors.New(`pq: connection refused to 10.0.0.5`)).Once()
+	mockDB.On("GetUserByEmail", "nobody@example.com").Return(nil, fmt.Errorf("failed to get user by email: %w", models.ErrNotFound)).Once()
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionLoginFailed)).Return(nil).Once()
+
+	register, _ := json.Marshal(RegisterRequest{FirstName: "New", LastName: "User", Email: "new@example.com", Password: "password123", PhoneNumber: "+15551234567"})
+	login, _ := json.Marshal(LoginRequest{Email: "nobody@example.com", Password: "password123"})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    []byte
+		status  int
+		code    string
+	}{
+		{"Storage failure", handler.Register, register, http.StatusInternalServerError, utils.CodeInternal},
+		{"Unknown email", handler.Login, login, http.StatusUnauthorized, utils.CodeInvalidCredentials},
+		{"Malformed body", handler.Register, []byte(`{"first_name":`), http.StatusBadRequest, utils.CodeBadRequest},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		tc.handler(w, httptest.NewRequest("POST", "/auth", bytes.NewBuffer(tc.body)))
+
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		assert.Equal(t, utils.ProblemContentType, w.Header().Get("Content-Type"), tc.name)
+		assert.NotContains(t, w.Body.String(), "10.0.0.5", tc.name)
+		assert.NotContains(t, w.Body.String(), "no rows", tc.name)
+
+		var problem utils.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), tc.name)
+		assert.Equal(t, tc.code, problem.Code, tc.name)
+		assert.Equal(t, tc.status, problem.Status, tc.name)
+	}
 	mockDB.AssertExpectations(t)
 }
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	handler := NewAuthHandler(models.NewMemoryStore(), nil)
+
+	register := func(email, phone string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(RegisterRequest{FirstName: "New", LastName: "User", Email: email, Password: "password123", PhoneNumber: phone})
+		w := httptest.NewRecorder()
+		handler.Register(w, httptest.NewRequest("POST", "/auth/register", bytes.NewBuffer(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, register("dup@example.com", "+15551230001").Code)
+
+	w := register("dup@example.com", "+15551230002")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var problem utils.Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, utils.CodeDuplicateEmail, problem.Code)
+	assert.NotContains(t, w.Body.String(), "constraint")
+
+	w = register("other@example.com", "+15551230001")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, utils.CodeDuplicatePhone, problem.Code)
+}
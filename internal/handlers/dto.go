@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+// Request and response bodies of the user endpoints. Handlers never decode
+// into or encode models.User directly, so clients cannot set internal fields
+// such as the id or password hash and secrets are never sent back.
+
+// RegisterRequest is the body of POST /auth/register. New users are always
+// active regular users.
+type RegisterRequest struct {
+	FirstName   string `json:"first_name" validate:"required,max=20"`
+	LastName    string `json:"last_name" validate:"required,max=20"`
+	PhoneNumber string `json:"phone_number" validate:"required,phone"`
+	Email       string `json:"email" validate:"required,email,max=100"`
+	Password    string `json:"password" validate:"required,password"`
+}
+
+// toUser returns the user to register
+func (r RegisterRequest) toUser() *models.User {
+	return &models.User{
+		FirstName:   r.FirstName,
+		LastName:    r.LastName,
+		PhoneNumber: r.PhoneNumber,
+		Email:       r.Email,
+		Password:    r.Password,
+		Status:      models.StatusActive,
+		Role:        models.RoleUser,
+	}
+}
+
+// UpdateUserRequest holds the fields of a user that PUT and PATCH can change
+type UpdateUserRequest struct {
+	FirstName   string `json:"first_name" validate:"required,max=20"`
+	LastName    string `json:"last_name" validate:"required,max=20"`
+	PhoneNumber string `json:"phone_number" validate:"required,phone"`
+	Email       string `json:"email" validate:"required,email,max=100"`
+	Status      string `json:"status" validate:"required,user_status"`
+	Role        string `json:"role" validate:"required,user_role"`
+}
+
+// newUpdateUserRequest returns the current values of the fields of user that
+// can be changed
+func newUpdateUserRequest(user *models.User) UpdateUserRequest {
+	return UpdateUserRequest{
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: user.PhoneNumber,
+		Email:       user.Email,
+		Status:      user.Status,
+		Role:        user.Role,
+	}
+}
+
+// changedFields returns the JSON names of the fields that differ from before
+func (u UpdateUserRequest) changedFields(before UpdateUserRequest) []string {
+	var changed []string
+	for _, field := range []struct {
+		name          string
+		before, after string
+	}{
+		{"first_name", before.FirstName, u.FirstName},
+		{"last_name", before.LastName, u.LastName},
+		{"phone_number", before.PhoneNumber, u.PhoneNumber},
+		{"email", before.Email, u.Email},
+		{"status", before.Status, u.Status},
+		{"role", before.Role, u.Role},
+	} {
+		if field.before != field.after {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
+
+// applyTo copies the requested values onto user
+func (u UpdateUserRequest) applyTo(user *models.User) {
+	user.FirstName = u.FirstName
+	user.LastName = u.LastName
+	user.PhoneNumber = u.PhoneNumber
+	user.Email = u.Email
+	user.Status = u.Status
+	user.Role = u.Role
+}
+
+// ChangeUserStatusRequest is the body of POST /users/{id}/status
+type ChangeUserStatusRequest struct {
+	Status string `json:"status" validate:"required,user_status"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// UserResponse is the public representation of a user
+type UserResponse struct {
+	ID          int64     `json:"id"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	PhoneNumber string    `json:"phone_number"`
+	Email       string    `json:"email"`
+	Status      string    `json:"status"`
+	Role        string    `json:"role"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// NewUserResponse maps user to its public representation
+func NewUserResponse(user *models.User) *UserResponse {
+	return &UserResponse{
+		ID:          user.ID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: user.PhoneNumber,
+		Email:       user.Email,
+		Status:      user.Status,
+		Role:        user.Role,
+		Version:     user.Version,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
+
+// NewUserResponses maps users to their public representations
+func NewUserResponses(users []*models.User) []*UserResponse {
+	responses := make([]*UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, NewUserResponse(user))
+	}
+	return responses
+}
+
+// UserStatusChangeResponse is the public representation of a status change.
+// ChangedBy is null once the admin who made the change has been purged.
+type UserStatusChangeResponse struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Reason    string    `json:"reason"`
+	ChangedBy *int64    `json:"changed_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewUserStatusChangeResponses maps status changes to their public
+// representations
+func NewUserStatusChangeResponses(changes []*models.UserStatusChange) []*UserStatusChangeResponse {
+	responses := make([]*UserStatusChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		resp := &UserStatusChangeResponse{
+			ID:        change.ID,
+			UserID:    change.UserID,
+			OldStatus: change.OldStatus,
+			NewStatus: change.NewStatus,
+			Reason:    change.Reason,
+			CreatedAt: change.CreatedAt,
+		}
+		if change.ChangedBy != 0 {
+			changedBy := change.ChangedBy
+			resp.ChangedBy = &changedBy
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+)
+
+// HealthCheck reports whether a dependency the server needs is usable. Its
+// error message is shown in the readiness response, so it should not carry
+// secrets.
+type HealthCheck func(ctx context.Context) error
+
+// Statuses reported by the readiness endpoint
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusFailing = "failing"
+)
+
+// errDraining fails readiness once the server starts shutting down
+var errDraining = errors.New("server is shutting down")
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+type HealthHandler struct {
+	checks   []namedHealthCheck
+	timeout  time.Duration
+	draining atomic.Bool
+	logger   *slog.Logger
+}
+
+// NewHealthHandler returns a HealthHandler whose readiness checks each get at
+// most timeout, logging to logger, or to the default logger when it is nil
+func NewHealthHandler(timeout time.Duration, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{timeout: timeout, logger: logging.OrDefault(logger)}
+}
+
+// AddCheck registers a readiness check. Checks must be added before the
+// handler serves requests.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedHealthCheck{name: name, check: check})
+}
+
+// StartDraining makes readiness fail from now on, so load balancers stop
+// sending traffic before the server shuts down
+func (h *HealthHandler) StartDraining() {
+	h.draining.Store(true)
+}
+
+// HealthCheckResult is the outcome of one readiness check
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body returned by GET /readyz
+type ReadinessResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// Liveness handles GET /healthz. It only shows the process is serving
+// requests, so orchestrators restart it when it is not.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": HealthStatusOK})
+}
+
+// Readiness handles GET /readyz, running every check concurrently. It
+// responds 200 when all of them pass and 503 otherwise or while draining.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Status: HealthStatusOK, Checks: make(map[string]HealthCheckResult, len(h.checks)+1)}
+
+	if h.draining.Load() {
+		resp.Checks["shutdown"] = HealthCheckResult{Status: HealthStatusFailing, Error: errDraining.Error()}
+	} else {
+		resp.Checks["shutdown"] = HealthCheckResult{Status: HealthStatusOK}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := h.run(r.Context(), c)
+			mu.Lock()
+			resp.Checks[c.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range resp.Checks {
+		if result.Status != HealthStatusOK {
+			resp.Status = HealthStatusFailing
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// run runs c with the handler's timeout and logs a failure
+func (h *HealthHandler) run(ctx context.Context, c namedHealthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := HealthCheckResult{Status: HealthStatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		h.logger.WarnContext(ctx, "readiness check failed", "check", c.name, "error", err)
+		result.Status = HealthStatusFailing
+		result.Error = logging.RedactString(err.Error())
+	}
+	return result
+}
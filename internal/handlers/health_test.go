@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getReadiness(t *testing.T, h *HealthHandler) (int, ReadinessResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Readiness(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	var resp ReadinessResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestLiveness(t *testing.T) {
+	h := NewHealthHandler(time.Second, nil)
+	h.AddCheck("database", func(ctx context.Context) error { return errors.New("down") })
+
+	w := httptest.NewRecorder()
+	h.Liveness(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	failing := errors.New("dial tcp: connect to postgres://app:s3cret@db/app refused")
+	healthy := true
+
+	h := NewHealthHandler(50*time.Millisecond, nil)
+	h.AddCheck("database", func(ctx context.Context) error {
+		if healthy {
+			return nil
+		}
+		return failing
+	})
+	h.AddCheck("slow", func(ctx context.Context) error {
+		if healthy {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	status, resp := getReadiness(t, h)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, HealthStatusOK, resp.Status)
+	assert.Len(t, resp.Checks, 3)
+	for name, result := range resp.Checks {
+		assert.Equal(t, HealthStatusOK, result.Status, name)
+	}
+
+	healthy = false
+	status, resp = getReadiness(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, HealthStatusFailing, resp.Status)
+	assert.Equal(t, HealthStatusFailing, resp.Checks["database"].Status)
+	assert.NotContains(t, resp.Checks["database"].Error, "s3cret")
+	assert.Equal(t, HealthStatusFailing, resp.Checks["slow"].Status)
+	assert.GreaterOrEqual(t, resp.Checks["slow"].LatencyMS, float64(50))
+	assert.Equal(t, HealthStatusOK, resp.Checks["shutdown"].Status)
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	h := NewHealthHandler(time.Second, nil)
+	h.AddCheck("database", func(ctx context.Context) error { return nil })
+	h.StartDraining()
+
+	status, resp := getReadiness(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, HealthStatusFailing, resp.Status)
+	assert.Equal(t, HealthStatusFailing, resp.Checks["shutdown"].Status)
+	assert.Equal(t, HealthStatusOK, resp.Checks["database"].Status)
+}
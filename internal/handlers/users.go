@@ -1,100 +1,616 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
 )
 
 type UserDBInterface interface {
-	GetAllUsers() ([]*models.User, error)
-	GetUserByID(id int64) (*models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUser(id int64) error
+	ListUsers(ctx context.Context, params models.UserListParams) (*models.UserPage, error)
+	SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserSearchPage, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) error
+	ChangeUserStatus(ctx context.Context, change *models.UserStatusChange) error
+	ListUserStatusChanges(ctx context.Context, userID int64) ([]*models.UserStatusChange, error)
+	AppendAuditEvent(ctx context.Context, event *audit.Event) error
+	WithTx(ctx context.Context, fn func(tx models.Store) error) error
 }
 
 type UserHandler struct {
 	dbImpl UserDBInterface
+	logger *slog.Logger
 }
 
-func NewUserHandler(user *models.User) *UserHandler {
-	return &UserHandler{dbImpl: user}
+// NewUserHandler returns a UserHandler logging to logger, or to the default
+// logger when it is nil
+func NewUserHandler(db UserDBInterface, logger *slog.Logger) *UserHandler {
+	return &UserHandler{dbImpl: db, logger: logging.OrDefault(logger)}
 }
 
+// UserListResponse is the envelope returned by GET /users
+type UserListResponse struct {
+	Data       []*UserResponse `json:"data"`
+	NextCursor *string         `json:"next_cursor"`
+	HasMore    bool            `json:"has_more"`
+}
+
+// GetUsers handles GET /users?limit=&cursor=&status=&email_contains=&created_after=&sort=
 func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.dbImpl.GetAllUsers()
+	params, err := parseUserListParams(r)
+	if err != nil {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, err.Error()))
+		return
+	}
+
+	page, err := h.dbImpl.ListUsers(r.Context(), params)
 	if err != nil {
-		http.Error(w, "failed to get users: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(users)
+	resp := UserListResponse{Data: NewUserResponses(page.Users), HasMore: page.HasMore}
+	if page.NextCursor != "" {
+		resp.NextCursor = &page.NextCursor
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseUserListParams reads the pagination, filter and sort query parameters
+// of GET /users. Limits above models.MaxUserPageSize are clamped.
+func parseUserListParams(r *http.Request) (models.UserListParams, error) {
+	query := r.URL.Query()
+	params := models.UserListParams{
+		Status:        query.Get("status"),
+		EmailContains: query.Get("email_contains"),
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "created_at:desc"
+	}
+	field, desc, err := models.ParseUserSort(sort)
+	if err != nil {
+		return params, fmt.Errorf("invalid sort: %w", err)
+	}
+	params.SortField, params.SortDesc = field, desc
+
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 {
+			return params, fmt.Errorf("invalid limit: must be a positive integer")
+		}
+	}
+
+	if params.Status != "" && !models.IsValidStatus(params.Status) {
+		return params, fmt.Errorf("invalid status %q", params.Status)
+	}
+
+	if createdAfter := query.Get("created_after"); createdAfter != "" {
+		params.CreatedAfter, err = time.Parse(time.RFC3339, createdAfter)
+		if err != nil {
+			return params, fmt.Errorf("invalid created_after: must be an RFC 3339 timestamp")
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		params.Cursor, err = params.DecodeUserCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	return params, nil
+}
+
+// UserSearchHit is a user matching a search, with its rank and the matching
+// fields highlighted
+type UserSearchHit struct {
+	*UserResponse
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// UserSearchResponse is the envelope returned by GET /users/search
+type UserSearchResponse struct {
+	Data       []*UserSearchHit `json:"data"`
+	NextCursor *string          `json:"next_cursor"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// SearchUsers handles GET /users/search?q=&limit=&cursor=
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := models.UserSearchParams{Query: query.Get("q")}
+
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "invalid limit: must be a positive integer"))
+			return
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		params.Offset, err = params.DecodeSearchCursor(cursor)
+		if err != nil {
+			utils.WriteProblem(w, r, err)
+			return
+		}
+	}
+
+	page, err := h.dbImpl.SearchUsers(r.Context(), params)
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	resp := UserSearchResponse{Data: []*UserSearchHit{}, HasMore: page.HasMore}
+	for _, result := range page.Results {
+		resp.Data = append(resp.Data, &UserSearchHit{UserResponse: NewUserResponse(result.User), Rank: result.Rank, Highlights: result.Highlights})
+	}
+	if page.NextCursor != "" {
+		resp.NextCursor = &page.NextCursor
+	}
+
+	json.NewEncoder(w).Encode(resp)
 }
 
 // GetUser handle GET /users/{id}
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	id, err := getUserIdFromRequest(r)
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidUserID)
 		return
 	}
 
-	user, err := h.dbImpl.GetUserByID(id)
+	user, err := h.dbImpl.GetUserByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to get user: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	if user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && utils.MatchETag(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(NewUserResponse(user))
 }
 
+// updateUserFields are the fields of UpdateUserRequest a merge patch may
+// contain
+var updateUserFields = []string{"first_name", "last_name", "phone_number", "email", "status", "role"}
+
+// mutableUserFields lists the fields each role may change with PUT and PATCH.
+// Regular users can only edit their own profile; admins can edit anyone's,
+// including the role. The status is changed with POST /users/{id}/status so
+// that every change has a reason.
+var mutableUserFields = map[string][]string{
+	models.RoleUser:  {"first_name", "last_name", "phone_number", "email"},
+	models.RoleAdmin: {"first_name", "last_name", "phone_number", "email", "role"},
+}
+
+// allowedUserFields returns the fields a caller with role may change
+func allowedUserFields(role string) []string {
+	if role == models.RoleAdmin {
+		return mutableUserFields[models.RoleAdmin]
+	}
+	return mutableUserFields[models.RoleUser]
+}
+
+// UpdateUser handles PUT /users/{id}. The body replaces every field the
+// caller may change, so each of them is required; admins must send the role
+// too. The status is not part of the replacement and keeps its value when
+// omitted, as does the role for regular users. Unknown and read-only fields
+// are rejected, as with PATCH.
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	claims, user, ok := h.userForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidPayload)
+		return
+	}
+
+	update := UpdateUserRequest{Status: user.Status, Role: user.Role}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		if field, unknown := strings.CutPrefix(err.Error(), "json: unknown field "); unknown {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, fmt.Sprintf("Unknown or read-only field %s.", field)))
+			return
+		}
+		utils.WriteProblem(w, r, errInvalidPayload)
+		return
+	}
+
+	var sent map[string]json.RawMessage
+	json.Unmarshal(body, &sent)
+	var missing utils.ValidationErrors
+	for _, field := range allowedUserFields(claims.Role) {
+		if _, ok := sent[field]; !ok {
+			missing = append(missing, utils.FieldError{Field: field, Rule: "required", Message: field + " is a required field"})
+		}
+	}
+	if len(missing) > 0 {
+		utils.WriteProblem(w, r, missing)
+		return
+	}
+
+	h.saveUserUpdate(w, r, claims, user, update)
+}
+
+// PatchUser handles PATCH /users/{id} with an RFC 7396 JSON merge patch of
+// the fields the caller may change. Every column is required, so a patch
+// cannot remove a field with null.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != utils.MergePatchContentType && mediaType != "application/json" {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnsupportedMediaType, utils.CodeUnsupportedMediaType, "Content-Type must be "+utils.MergePatchContentType+"."))
+		return
+	}
+
+	claims, user, ok := h.userForUpdate(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidPayload)
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "The merge patch must be a JSON object."))
+		return
+	}
+	for name, value := range patch {
+		if !slices.Contains(updateUserFields, name) {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, fmt.Sprintf("Unknown or read-only field %q.", name)))
+			return
+		}
+		if string(value) == "null" {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, fmt.Sprintf("Field %q cannot be removed.", name)))
+			return
+		}
+	}
+
+	current, _ := json.Marshal(newUpdateUserRequest(user))
+	patched, err := utils.MergePatch(current, body)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidPayload)
+		return
+	}
+
+	var update UpdateUserRequest
+	if err := json.Unmarshal(patched, &update); err != nil {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "Fields must be strings."))
+		return
+	}
+
+	h.saveUserUpdate(w, r, claims, user, update)
+}
+
+// userForUpdate loads the user addressed by a PUT or PATCH request after
+// checking that the caller may edit it. It writes the error response and
+// returns false when the request cannot proceed.
+func (h *UserHandler) userForUpdate(w http.ResponseWriter, r *http.Request) (utils.AuthClaims, *models.User, bool) {
 	id, err := getUserIdFromRequest(r)
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidUserID)
+		return utils.AuthClaims{}, nil, false
+	}
+
+	claims, ok := selfOrAdmin(w, r, id, "Not allowed to edit this user.")
+	if !ok {
+		return claims, nil, false
+	}
+
+	// The update is based on this version, so it must not lag behind
+	user, err := h.dbImpl.GetUserByID(models.WithPrimary(r.Context()), id)
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return claims, nil, false
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !utils.MatchETag(ifMatch, userETag(user), false) {
+		utils.WriteProblem(w, r, errPreconditionFailed)
+		return claims, nil, false
+	}
+
+	return claims, user, true
+}
+
+// selfOrAdmin checks that the caller is the user with the given ID or an
+// admin. Otherwise it writes the error response, using forbidden as the
+// detail when the caller is authenticated, and returns false.
+func selfOrAdmin(w http.ResponseWriter, r *http.Request, id int64, forbidden string) (utils.AuthClaims, bool) {
+	claims, ok := utils.AuthClaimsFromContext(r.Context())
+	if !ok {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnauthorized, utils.CodeUnauthorized, "Authentication required."))
+		return claims, false
+	}
+	if claims.Role != models.RoleAdmin && claims.UserID != id {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusForbidden, utils.CodeForbidden, forbidden))
+		return claims, false
+	}
+	return claims, true
+}
+
+// saveUserUpdate checks that the caller's role may change every modified
+// field, validates the result and stores it.
+func (h *UserHandler) saveUserUpdate(w http.ResponseWriter, r *http.Request, claims utils.AuthClaims, user *models.User, update UpdateUserRequest) {
+	allowed := allowedUserFields(claims.Role)
+	changed := update.changedFields(newUpdateUserRequest(user))
+	for _, field := range changed {
+		if field == "status" {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusForbidden, utils.CodeForbidden, "The status can only be changed with POST /users/{id}/status."))
+			return
+		}
+		if !slices.Contains(allowed, field) {
+			utils.WriteProblem(w, r, utils.NewProblem(http.StatusForbidden, utils.CodeForbidden, fmt.Sprintf("Not allowed to change %s.", field)))
+			return
+		}
+	}
+
+	// Stored values that predate the current rules, such as phone numbers
+	// not in E.164 format, must not keep the user from editing other fields
+	validationErrors := slices.DeleteFunc(utils.ValidateStruct(update), func(fe utils.FieldError) bool {
+		return !slices.Contains(changed, fe.Field)
+	})
+	if len(validationErrors) > 0 {
+		utils.WriteProblem(w, r, validationErrors)
 		return
 	}
 
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	before := *user
+	update.applyTo(user)
+	diff, err := userAuditDiff(&before, user)
+	if err != nil {
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	user.ID = id
-	err = h.dbImpl.UpdateUser(&user)
+	// The version loaded by userForUpdate makes the update conditional, so a
+	// concurrent change since then is reported instead of overwritten.
+	err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if err := tx.UpdateUser(r.Context(), user); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, audit.ActionUserUpdate, user.ID)
+		event.Diff = diff
+		return tx.AppendAuditEvent(r.Context(), event)
+	})
 	if err != nil {
-		http.Error(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(user)
+	w.Header().Set("ETag", userETag(user))
+	json.NewEncoder(w).Encode(NewUserResponse(user))
 }
 
+var (
+	errInvalidUserID      = utils.NewProblem(http.StatusBadRequest, utils.CodeBadRequest, "Invalid user id.")
+	errPreconditionFailed = utils.NewProblem(http.StatusPreconditionFailed, utils.CodePreconditionFailed, "The user was modified.")
+)
+
+// DeleteUser handles DELETE /users/{id}. The user is soft deleted and can be
+// restored until the purge job removes it. Users can delete themselves;
+// admins can delete anyone. With If-Match, the user is only deleted if it is
+// still at the given version.
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id, err := getUserIdFromRequest(r)
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		utils.WriteProblem(w, r, errInvalidUserID)
+		return
+	}
+	if _, ok := selfOrAdmin(w, r, id, "Not allowed to delete this user."); !ok {
 		return
 	}
 
-	err = h.dbImpl.DeleteUser(id)
+	ifMatch := r.Header.Get("If-Match")
+	err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if ifMatch != "" {
+			user, err := tx.GetUserByID(r.Context(), id)
+			if err != nil {
+				return err
+			}
+			if !utils.MatchETag(ifMatch, userETag(user), false) {
+				return errPreconditionFailed
+			}
+		}
+
+		if err := tx.DeleteUser(r.Context(), id); err != nil {
+			return err
+		}
+		return tx.AppendAuditEvent(r.Context(), newAuditEvent(r, audit.ActionUserDelete, id))
+	})
 	if err != nil {
-		http.Error(w, "Failed to delete user: "+err.Error(), http.StatusInternalServerError)
+		utils.WriteProblem(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreUser handles POST /users/{id}/restore, undoing a delete that has
+// not been purged yet
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIdFromRequest(r)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidUserID)
+		return
+	}
+
+	var user *models.User
+	err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if err := tx.RestoreUser(r.Context(), id); err != nil {
+			return err
+		}
+		if err := tx.AppendAuditEvent(r.Context(), newAuditEvent(r, audit.ActionUserRestore, id)); err != nil {
+			return err
+		}
+
+		user, err = tx.GetUserByID(r.Context(), id)
+		return err
+	})
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", userETag(user))
+	json.NewEncoder(w).Encode(NewUserResponse(user))
+}
+
+// ChangeUserStatus handles POST /users/{id}/status. Admins set the status of
+// another user and give a reason, which is recorded with their ID. Banning or
+// deactivating a user revokes their refresh tokens. With If-Match, the status
+// only changes if the user is still at the given version.
+func (h *UserHandler) ChangeUserStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIdFromRequest(r)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidUserID)
+		return
+	}
+
+	claims, ok := utils.AuthClaimsFromContext(r.Context())
+	if !ok {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnauthorized, utils.CodeUnauthorized, "Authentication required."))
+		return
+	}
+	if claims.UserID == id {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusForbidden, utils.CodeForbidden, "Admins cannot change their own status."))
+		return
+	}
+
+	var req ChangeUserStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteProblem(w, r, errInvalidPayload)
+		return
+	}
+	if validationErrors := utils.ValidateStruct(req); validationErrors != nil {
+		utils.WriteProblem(w, r, validationErrors)
+		return
+	}
+
+	change := &models.UserStatusChange{UserID: id, NewStatus: req.Status, Reason: req.Reason, ChangedBy: claims.UserID}
+	ifMatch := r.Header.Get("If-Match")
+	var user *models.User
+	err = h.dbImpl.WithTx(models.WithAuditAppend(r.Context()), func(tx models.Store) error {
+		if ifMatch != "" {
+			current, err := tx.GetUserByID(r.Context(), id)
+			if err != nil {
+				return err
+			}
+			if !utils.MatchETag(ifMatch, userETag(current), false) {
+				return errPreconditionFailed
+			}
+		}
+
+		if err := tx.ChangeUserStatus(r.Context(), change); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(r, audit.ActionUserStatusChange, id)
+		event.Diff, err = audit.Diff(map[string]string{"status": change.OldStatus}, map[string]string{"status": change.NewStatus})
+		if err != nil {
+			return err
+		}
+		if err := tx.AppendAuditEvent(r.Context(), event); err != nil {
+			return err
+		}
+
+		user, err = tx.GetUserByID(r.Context(), id)
+		return err
+	})
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "user status changed", "target_user_id", id, "old_status", change.OldStatus, "new_status", change.NewStatus)
+
+	w.Header().Set("ETag", userETag(user))
+	json.NewEncoder(w).Encode(NewUserResponse(user))
+}
+
+// UserStatusChangeListResponse is the envelope returned by
+// GET /users/{id}/status-changes
+type UserStatusChangeListResponse struct {
+	Data []*UserStatusChangeResponse `json:"data"`
+}
+
+// ListUserStatusChanges handles GET /users/{id}/status-changes, newest first
+func (h *UserHandler) ListUserStatusChanges(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIdFromRequest(r)
+	if err != nil {
+		utils.WriteProblem(w, r, errInvalidUserID)
+		return
+	}
+
+	// Unknown and deleted users are reported as missing. Both reads go to
+	// the primary: replicas lag by different amounts, so the check and the
+	// list could otherwise disagree about a user that just changed.
+	ctx := models.WithPrimary(r.Context())
+	if _, err := h.dbImpl.GetUserByID(ctx, id); err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	changes, err := h.dbImpl.ListUserStatusChanges(ctx, id)
+	if err != nil {
+		utils.WriteProblem(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(UserStatusChangeListResponse{Data: NewUserStatusChangeResponses(changes)})
+}
+
+// userAuditDiff returns the audit diff of the editable fields of a user
+// between two states; before is nil for a new user
+func userAuditDiff(before, after *models.User) (json.RawMessage, error) {
+	var old any
+	if before != nil {
+		old = newUpdateUserRequest(before)
+	}
+	return audit.Diff(old, newUpdateUserRequest(after))
+}
+
+// userETag returns the entity tag of the current version of user
+func userETag(user *models.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
 func getUserIdFromRequest(r *http.Request) (int64, error) {
 	vars := mux.Vars(r)
 	userIdStr := vars["id"]
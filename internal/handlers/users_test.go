@@ -2,20 +2,26 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/mocks"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetUsers(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewUserHandler(nil)
+	handler := NewUserHandler(nil, nil)
 	handler.dbImpl = mockDB
 
 	users := []*models.User{
@@ -23,25 +29,68 @@ func TestGetUsers(t *testing.T) {
 		{ID: 2, FirstName: "User2", LastName: "Test", Email: "user2@example.com"},
 	}
 
-	mockDB.On("GetAllUsers").Return(users, nil)
+	params := models.UserListParams{Status: "active", SortField: models.SortByID, Limit: 2}
+	mockDB.On("ListUsers", params).Return(&models.UserPage{Users: users, NextCursor: "next", HasMore: true}, nil)
 
-	req := httptest.NewRequest("GET", "/users", nil)
+	req := httptest.NewRequest("GET", "/users?status=active&sort=id:asc&limit=2", nil)
 	w := httptest.NewRecorder()
 
 	handler.GetUsers(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var returnedUsers []*models.User
-	json.Unmarshal(w.Body.Bytes(), &returnedUsers)
+	var resp UserListResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
 
-	assert.Equal(t, users, returnedUsers)
+	assert.Equal(t, NewUserResponses(users), resp.Data)
+	assert.True(t, resp.HasMore)
+	assert.Equal(t, "next", *resp.NextCursor)
 	mockDB.AssertExpectations(t)
 }
 
+func TestGetUsersPaginatesMemoryStore(t *testing.T) {
+	store := models.NewMemoryStore()
+	for i := 0; i < 3; i++ {
+		user := &models.User{FirstName: "Page", LastName: "User", Email: fmt.Sprintf("page%d@example.com", i), PhoneNumber: fmt.Sprintf("+100%d", i), Password: "password123"}
+		assert.NoError(t, store.RegisterUser(context.Background(), user))
+	}
+	handler := NewUserHandler(store, nil)
+
+	var ids []int64
+	url := "/users?limit=2&sort=id:asc"
+	for {
+		w := httptest.NewRecorder()
+		handler.GetUsers(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp UserListResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		for _, user := range resp.Data {
+			ids = append(ids, user.ID)
+		}
+		if !resp.HasMore {
+			assert.Nil(t, resp.NextCursor)
+			break
+		}
+		url = "/users?limit=2&sort=id:asc&cursor=" + *resp.NextCursor
+	}
+
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+}
+
+func TestGetUsersRejectsInvalidParams(t *testing.T) {
+	handler := NewUserHandler(models.NewMemoryStore(), nil)
+
+	for _, query := range []string{"limit=0", "limit=abc", "sort=password_hash", "sort=id:sideways", "status=deleted", "created_after=yesterday", "cursor=bogus"} {
+		w := httptest.NewRecorder()
+		handler.GetUsers(w, httptest.NewRequest("GET", "/users?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
 func TestGetUser(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewUserHandler(nil)
+	handler := NewUserHandler(nil, nil)
 	handler.dbImpl = mockDB
 
 	user := &models.User{ID: 1, FirstName: "User1", LastName: "Test", Email: "user1@example.com"}
@@ -65,17 +114,37 @@ func TestGetUser(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestGetUserNeverEncodesSecrets(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewUserHandler(mockDB, nil)
+
+	user := &models.User{ID: 1, FirstName: "User1", LastName: "Test", Email: "user1@example.com", Password: "plain-secret", PasswordHash: "hash-secret"}
+	mockDB.On("GetUserByID", int64(1)).Return(user, nil)
+
+	w := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.GetUser)
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.NotContains(t, w.Body.String(), "password")
+}
+
 func TestUpdateUser(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewUserHandler(nil)
+	handler := NewUserHandler(nil, nil)
 	handler.dbImpl = mockDB
 
-	user := &models.User{ID: 1, FirstName: "Updated", LastName: "User", Email: "updated@example.com"}
+	existing := &models.User{ID: 1, FirstName: "Old", LastName: "User", PhoneNumber: "+1000", Email: "old@example.com", Status: models.StatusActive, Role: models.RoleUser}
+	user := &models.User{ID: 1, FirstName: "Updated", LastName: "User", PhoneNumber: "+1000", Email: "updated@example.com", Status: models.StatusActive, Role: models.RoleUser}
 
+	mockDB.On("GetUserByID", int64(1)).Return(existing, nil)
 	mockDB.On("UpdateUser", user).Return(nil)
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionUserUpdate)).Return(nil)
 
-	jsonBody, _ := json.Marshal(user)
-	req := httptest.NewRequest("PUT", "/users/1", bytes.NewBuffer(jsonBody))
+	jsonBody, _ := json.Marshal(map[string]string{"first_name": "Updated", "last_name": "User", "phone_number": "+1000", "email": "updated@example.com"})
+	req := withClaims(httptest.NewRequest("PUT", "/users/1", bytes.NewBuffer(jsonBody)), 1, models.RoleUser)
 	w := httptest.NewRecorder()
 
 	router := mux.NewRouter()
@@ -86,14 +155,148 @@ func TestUpdateUser(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestUpdateUserIsFullReplacement(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := &models.User{FirstName: "Put", LastName: "User", PhoneNumber: "+3000", Email: "put@example.com", Password: "password123"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", NewUserHandler(store, nil).UpdateUser)
+
+	// Fields missing from a replacement are not silently blanked
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withClaims(httptest.NewRequest("PUT", "/users/1", strings.NewReader(`{"first_name":"Only"}`)), 1, models.RoleUser))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	stored, _ := store.GetUserByID(context.Background(), 1)
+	assert.Equal(t, "put@example.com", stored.Email)
+}
+
+func TestUpdateUserFields(t *testing.T) {
+	store := models.NewMemoryStore()
+	for i := 1; i <= 2; i++ {
+		user := &models.User{FirstName: "Put", LastName: "User", PhoneNumber: fmt.Sprintf("+310%d", i), Email: fmt.Sprintf("put%d@example.com", i), Password: "password123"}
+		assert.NoError(t, store.RegisterUser(context.Background(), user))
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", NewUserHandler(store, nil).UpdateUser)
+
+	put := func(path, body, role string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(httptest.NewRequest("PUT", path, strings.NewReader(body)), 1, role))
+		return w
+	}
+	fields := `"first_name":"Put","last_name":"Replaced","phone_number":"+3101","email":"put1@example.com"`
+
+	// Read-only and unknown fields are rejected rather than dropped
+	w := put("/users/1", `{`+fields+`,"id":5}`, models.RoleUser)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "read-only field")
+	w = put("/users/1", `{`+fields+`,"nickname":"x"}`, models.RoleUser)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Regular users may omit the status and the role, which they cannot change
+	w = put("/users/1", `{`+fields+`}`, models.RoleUser)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	stored, _ := store.GetUserByID(context.Background(), 1)
+	assert.Equal(t, "Replaced", stored.LastName)
+	assert.Equal(t, models.StatusActive, stored.Status)
+	assert.Equal(t, models.RoleUser, stored.Role)
+
+	// Admins may change the role, so they must send it
+	other := `"first_name":"Put","last_name":"User","phone_number":"+3102","email":"put2@example.com"`
+	w = put("/users/2", `{`+other+`}`, models.RoleAdmin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"role"`)
+
+	w = put("/users/2", `{`+other+`,"role":"admin"}`, models.RoleAdmin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	stored, _ = store.GetUserByID(context.Background(), 2)
+	assert.Equal(t, models.RoleAdmin, stored.Role)
+	assert.Equal(t, models.StatusActive, stored.Status)
+}
+
+func TestPatchUser(t *testing.T) {
+	store := models.NewMemoryStore()
+	for i := 1; i <= 2; i++ {
+		user := &models.User{FirstName: "Patch", LastName: "User", Email: fmt.Sprintf("patch%d@example.com", i), PhoneNumber: fmt.Sprintf("+400%d", i), Password: "password123"}
+		assert.NoError(t, store.RegisterUser(context.Background(), user))
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", NewUserHandler(store, nil).PatchUser)
+
+	patch := func(path, body, role string, callerID int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, callerID, role))
+		return w
+	}
+
+	before, _ := store.GetUserByID(context.Background(), 1)
+
+	w := patch("/users/1", `{"first_name":"Patched"}`, models.RoleUser, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated models.User
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, "Patched", updated.FirstName)
+	assert.Equal(t, "User", updated.LastName)
+	assert.Equal(t, "patch1@example.com", updated.Email)
+	assert.True(t, updated.UpdatedAt.After(before.UpdatedAt))
+
+	tests := []struct {
+		name           string
+		path, body     string
+		role           string
+		expectedStatus int
+	}{
+		{"Status as user", "/users/1", `{"status":"banned"}`, models.RoleUser, http.StatusForbidden},
+		{"Role as user", "/users/1", `{"role":"admin"}`, models.RoleUser, http.StatusForbidden},
+		{"Unchanged status as user", "/users/1", `{"status":"active"}`, models.RoleUser, http.StatusOK},
+		{"Other user as user", "/users/2", `{"first_name":"Nope"}`, models.RoleUser, http.StatusForbidden},
+		{"Status as admin", "/users/2", `{"status":"banned"}`, models.RoleAdmin, http.StatusForbidden},
+		{"Role as admin", "/users/2", `{"role":"admin"}`, models.RoleAdmin, http.StatusOK},
+		{"Invalid role", "/users/2", `{"role":"root"}`, models.RoleAdmin, http.StatusBadRequest},
+		{"Invalid email", "/users/1", `{"email":"not-an-email"}`, models.RoleUser, http.StatusBadRequest},
+		{"Null field", "/users/1", `{"last_name":null}`, models.RoleUser, http.StatusBadRequest},
+		{"Read-only field", "/users/1", `{"id":5}`, models.RoleUser, http.StatusBadRequest},
+		{"Wrong type", "/users/1", `{"first_name":5}`, models.RoleUser, http.StatusBadRequest},
+		{"Not an object", "/users/1", `["first_name"]`, models.RoleUser, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		w := patch(tc.path, tc.body, tc.role, 1)
+		assert.Equal(t, tc.expectedStatus, w.Code, tc.name)
+	}
+
+	promoted, _ := store.GetUserByID(context.Background(), 2)
+	assert.Equal(t, models.StatusActive, promoted.Status)
+	assert.Equal(t, models.RoleAdmin, promoted.Role)
+	assert.Equal(t, "Patch", promoted.FirstName)
+
+	req := httptest.NewRequest("PATCH", "/users/1", strings.NewReader(`{"first_name":"X"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, withClaims(req, 1, models.RoleUser))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+// withClaims authenticates req as the given user, as JWTMiddleware would
+func withClaims(req *http.Request, userID int64, role string) *http.Request {
+	return req.WithContext(utils.WithAuthClaims(req.Context(), utils.AuthClaims{UserID: userID, Role: role}))
+}
+
 func TestDeleteUser(t *testing.T) {
 	mockDB := new(mocks.MockDB)
-	handler := NewUserHandler(nil)
+	handler := NewUserHandler(nil, nil)
 	handler.dbImpl = mockDB
 
 	mockDB.On("DeleteUser", int64(1)).Return(nil)
+	mockDB.On("AppendAuditEvent", auditAction(audit.ActionUserDelete)).Return(nil)
 
-	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	req := withClaims(httptest.NewRequest("DELETE", "/users/1", nil), 1, models.RoleUser)
 	w := httptest.NewRecorder()
 
 	router := mux.NewRouter()
@@ -103,3 +306,366 @@ func TestDeleteUser(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, w.Code)
 	mockDB.AssertExpectations(t)
 }
+
+func TestDeleteMissingUser(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewUserHandler(nil, nil)
+	handler.dbImpl = mockDB
+
+	mockDB.On("DeleteUser", int64(1)).Return(fmt.Errorf("failed to delete user: %w", models.ErrNotFound))
+
+	w := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.DeleteUser)
+	router.ServeHTTP(w, withClaims(httptest.NewRequest("DELETE", "/users/1", nil), 1, models.RoleUser))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "AppendAuditEvent", auditAction(audit.ActionUserDelete))
+}
+
+func TestDeleteOtherUserForbidden(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	handler := NewUserHandler(nil, nil)
+	handler.dbImpl = mockDB
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.DeleteUser)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withClaims(httptest.NewRequest("DELETE", "/users/2", nil), 1, models.RoleUser))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/users/2", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mockDB.AssertNotCalled(t, "DeleteUser", int64(2))
+	mockDB.AssertNotCalled(t, "AppendAuditEvent", auditAction(audit.ActionUserDelete))
+}
+
+func TestSearchUsersWithMemoryStore(t *testing.T) {
+	store := models.NewMemoryStore()
+	for i, name := range []string{"Smith", "Smithson", "Jones"} {
+		user := &models.User{FirstName: "Search", LastName: name, Email: fmt.Sprintf("search%d@example.com", i), PhoneNumber: fmt.Sprintf("+200%d", i), Password: "password123"}
+		assert.NoError(t, store.RegisterUser(context.Background(), user))
+	}
+	handler := NewUserHandler(store, nil)
+
+	var hits []*UserSearchHit
+	url := "/users/search?q=smith&limit=1"
+	for {
+		w := httptest.NewRecorder()
+		handler.SearchUsers(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp UserSearchResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		hits = append(hits, resp.Data...)
+		if !resp.HasMore {
+			break
+		}
+		url = "/users/search?q=smith&limit=1&cursor=" + *resp.NextCursor
+	}
+
+	if assert.Len(t, hits, 2) {
+		assert.Equal(t, "Smith", hits[0].LastName)
+		assert.Equal(t, "<mark>Smith</mark>", hits[0].Highlights["last_name"])
+		assert.Greater(t, hits[0].Rank, hits[1].Rank)
+		assert.Equal(t, "<mark>Smith</mark>son", hits[1].Highlights["last_name"])
+	}
+}
+
+func TestSearchUsersRejectsInvalidParams(t *testing.T) {
+	handler := NewUserHandler(models.NewMemoryStore(), nil)
+
+	for _, query := range []string{"", "q=", "q=smith&limit=0", "q=smith&cursor=bogus"} {
+		w := httptest.NewRecorder()
+		handler.SearchUsers(w, httptest.NewRequest("GET", "/users/search?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestUserETags(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := &models.User{FirstName: "Etag", LastName: "User", PhoneNumber: "+5000", Email: "etag@example.com", Password: "password123"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
+	router.HandleFunc("/users/{id}", handler.PatchUser).Methods("PATCH")
+	router.HandleFunc("/users/{id}", handler.DeleteUser).Methods("DELETE")
+
+	send := func(method, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, 1, models.RoleUser))
+		return w
+	}
+
+	w := send("GET", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = send("GET", "", map[string]string{"If-None-Match": `W/"1"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = send("PATCH", `{"first_name":"Stale"}`, map[string]string{"If-Match": `"0"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send("PATCH", `{"first_name":"Fresh"}`, map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = send("GET", "", map[string]string{"If-None-Match": `"1"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send("DELETE", "", map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = send("DELETE", "", map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := &models.User{FirstName: "Restore", LastName: "User", PhoneNumber: "+6000", Email: "restore@example.com", Password: "password123"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.DeleteUser).Methods("DELETE")
+	router.HandleFunc("/users/{id}/restore", handler.RestoreUser).Methods("POST")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, withClaims(httptest.NewRequest("DELETE", "/users/1", nil), 1, models.RoleUser))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, err := store.GetUserByID(context.Background(), 1)
+	assert.Error(t, err)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/users/1/restore", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var restored models.User
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.Equal(t, "restore@example.com", restored.Email)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	// Only deleted users can be restored
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/users/1/restore", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPatchUserWithLegacyPhone(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := &models.User{FirstName: "Legacy", LastName: "User", PhoneNumber: "555-0100", Email: "legacy@example.com", Password: "password123"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.PatchUser).Methods("PATCH")
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/users/%d", user.ID), strings.NewReader(body))
+		req.Header.Set("Content-Type", utils.MergePatchContentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, user.ID, models.RoleUser))
+		return w
+	}
+
+	// Only the changed fields are held to the current rules
+	w := patch(`{"first_name":"Renamed"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = patch(`{"phone_number":"555-0199"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "phone_number")
+}
+
+func TestUserDomainErrors(t *testing.T) {
+	store := models.NewMemoryStore()
+	for _, user := range []*models.User{
+		{FirstName: "First", LastName: "User", PhoneNumber: "+15550000001", Email: "first@example.com", Password: "password123"},
+		{FirstName: "Second", LastName: "User", PhoneNumber: "+15550000002", Email: "second@example.com", Password: "password123"},
+	} {
+		assert.NoError(t, store.RegisterUser(context.Background(), user))
+	}
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
+	router.HandleFunc("/users/{id}", handler.PatchUser).Methods("PATCH")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"Missing user", "GET", "/users/99", "", http.StatusNotFound, utils.CodeNotFound},
+		{"Patch missing user", "PATCH", "/users/99", `{"first_name":"Ghost"}`, http.StatusNotFound, utils.CodeNotFound},
+		{"Taken email", "PATCH", "/users/2", `{"email":"first@example.com"}`, http.StatusConflict, utils.CodeDuplicateEmail},
+		{"Taken phone number", "PATCH", "/users/2", `{"phone_number":"+15550000001"}`, http.StatusConflict, utils.CodeDuplicatePhone},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", utils.MergePatchContentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, 1, models.RoleAdmin))
+
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		var problem utils.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), tc.name)
+		assert.Equal(t, tc.code, problem.Code, tc.name)
+	}
+}
+
+func TestChangeUserStatus(t *testing.T) {
+	store := models.NewMemoryStore()
+	admin := &models.User{FirstName: "Admin", LastName: "User", PhoneNumber: "+15550001001", Email: "admin@example.com", Password: "password123", Role: models.RoleAdmin}
+	user := &models.User{FirstName: "Regular", LastName: "User", PhoneNumber: "+15550001002", Email: "regular@example.com", Password: "password123"}
+	for _, u := range []*models.User{admin, user} {
+		assert.NoError(t, store.RegisterUser(context.Background(), u))
+	}
+
+	authHandler := NewAuthHandler(store, nil)
+	login := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Email: user.Email, Password: "password123"})
+		w := httptest.NewRecorder()
+		authHandler.Login(w, httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(body)))
+		return w
+	}
+	refresh := func(token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(RefreshRequest{UserID: user.ID, RefreshToken: token})
+		w := httptest.NewRecorder()
+		authHandler.RefreshToken(w, httptest.NewRequest("POST", "/auth/refresh_token", bytes.NewBuffer(body)))
+		return w
+	}
+	problemCode := func(w *httptest.ResponseRecorder) string {
+		var problem utils.Problem
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		return problem.Code
+	}
+
+	w := login()
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/status", handler.ChangeUserStatus).Methods("POST")
+	router.HandleFunc("/users/{id}/status-changes", handler.ListUserStatusChanges).Methods("GET")
+	send := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, withClaims(req, admin.ID, models.RoleAdmin))
+		return w
+	}
+
+	path := fmt.Sprintf("/users/%d/status", user.ID)
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		header map[string]string
+		status int
+	}{
+		{"Own status", fmt.Sprintf("/users/%d/status", admin.ID), `{"status":"inactive","reason":"leaving"}`, nil, http.StatusForbidden},
+		{"Missing reason", path, `{"status":"banned"}`, nil, http.StatusBadRequest},
+		{"Invalid status", path, `{"status":"deleted","reason":"spam"}`, nil, http.StatusBadRequest},
+		{"Unknown user", "/users/99/status", `{"status":"banned","reason":"spam"}`, nil, http.StatusNotFound},
+		{"Stale If-Match", path, `{"status":"banned","reason":"spam"}`, map[string]string{"If-Match": `"7"`}, http.StatusPreconditionFailed},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.status, send("POST", tc.path, tc.body, tc.header).Code, tc.name)
+	}
+
+	w = send("POST", path, `{"status":"banned","reason":"spam"}`, map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var banned UserResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &banned))
+	assert.Equal(t, models.StatusBanned, banned.Status)
+
+	// Banned users can neither log in nor use the sessions they had
+	w = login()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, utils.CodeAccountSuspended, problemCode(w))
+	w = refresh(tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, utils.CodeInvalidToken, problemCode(w))
+
+	// A refresh token that survived, e.g. one issued concurrently, is refused too
+	raw := "surviving-refresh-token"
+	hash, _ := utils.HashToken(context.Background(), raw)
+	assert.NoError(t, store.CreateRefreshToken(context.Background(), &models.RefreshToken{UserID: user.ID, Token: hash, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}))
+	w = refresh(raw)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, utils.CodeAccountSuspended, problemCode(w))
+
+	w = send("GET", fmt.Sprintf("/users/%d/status-changes", user.ID), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history UserStatusChangeListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	if assert.Len(t, history.Data, 1) {
+		change := history.Data[0]
+		assert.Equal(t, models.StatusActive, change.OldStatus)
+		assert.Equal(t, models.StatusBanned, change.NewStatus)
+		assert.Equal(t, "spam", change.Reason)
+		if assert.NotNil(t, change.ChangedBy) {
+			assert.Equal(t, admin.ID, *change.ChangedBy)
+		}
+	}
+	assert.Equal(t, http.StatusNotFound, send("GET", "/users/99/status-changes", "", nil).Code)
+
+	assert.Equal(t, http.StatusOK, send("POST", path, `{"status":"active","reason":"appeal accepted"}`, nil).Code)
+	assert.Equal(t, http.StatusOK, login().Code)
+}
+
+// primaryReadStore records whether each user and status change read asked
+// for the primary
+type primaryReadStore struct {
+	*models.MemoryStore
+	reads []bool
+}
+
+func (s *primaryReadStore) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	s.reads = append(s.reads, models.PrimaryRequested(ctx))
+	return s.MemoryStore.GetUserByID(ctx, id)
+}
+
+func (s *primaryReadStore) ListUserStatusChanges(ctx context.Context, userID int64) ([]*models.UserStatusChange, error) {
+	s.reads = append(s.reads, models.PrimaryRequested(ctx))
+	return s.MemoryStore.ListUserStatusChanges(ctx, userID)
+}
+
+func TestListUserStatusChangesReadsPrimary(t *testing.T) {
+	store := &primaryReadStore{MemoryStore: models.NewMemoryStore()}
+	user := &models.User{FirstName: "History", LastName: "User", PhoneNumber: "+7000", Email: "history@example.com", Password: "password123"}
+	assert.NoError(t, store.RegisterUser(context.Background(), user))
+
+	handler := NewUserHandler(store, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/users/{id}/status-changes", handler.ListUserStatusChanges).Methods("GET")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/users/%d/status-changes", user.ID), nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []bool{true, true}, store.reads)
+}
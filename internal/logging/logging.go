@@ -0,0 +1,125 @@
+// Package logging builds the structured slog logger used by the server. Every
+// record is passed through redaction, and attributes stored in the context
+// with WithAttrs, such as the request ID, route and user ID, are added to
+// every record logged with that context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats accepted by New
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ParseLevel parses a log level: "debug", "info", "warn" or "error"
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return lvl, fmt.Errorf("invalid log level %q", level)
+	}
+	return lvl, nil
+}
+
+// New returns a logger writing records at or above level to w in the given
+// format. Passing a *slog.LevelVar lets the level change while the logger is
+// in use.
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// OrDefault returns logger, or slog.Default() when it is nil, for
+// constructors that accept an optional logger
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx carrying attrs in addition to the ones it
+// already carries. They are added to every record logged with the context.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	combined := make([]slog.Attr, 0, len(existing)+len(attrs))
+	combined = append(append(combined, existing...), attrs...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// contextHandler adds the attributes stored by WithAttrs to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok && len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestInfo collects what AccessLog reports about a request from the
+// middlewares and handlers it wraps, which see copies of its context
+type requestInfo struct {
+	id     string
+	route  string
+	userID int64
+}
+
+type requestInfoKey struct{}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// RequestIDFromContext returns the ID AccessLog assigned to the request, or
+// "" outside of it
+func RequestIDFromContext(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// WithUserID returns a copy of ctx that logs the ID of the authenticated
+// user, and reports it in the access log line of the request
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.userID = userID
+	}
+	return WithAttrs(ctx, slog.Int64("user_id", userID))
+}
@@ -0,0 +1,196 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return logger, &buf
+}
+
+func decodeRecord(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode log record %q: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestNew_RejectsInvalidSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestNew_FiltersByLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	if err != nil {
+		t.Fatalf("ParseLevel failed: %v", err)
+	}
+	var levelVar slog.LevelVar
+	levelVar.Set(level)
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatText, &levelVar)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("expected info record to be dropped, got %q", buf.String())
+	}
+	logger.Warn("kept")
+	if !strings.Contains(buf.String(), "kept") {
+		t.Errorf("expected warn record to be written, got %q", buf.String())
+	}
+
+	levelVar.Set(slog.LevelInfo)
+	logger.Info("raised")
+	if !strings.Contains(buf.String(), "raised") {
+		t.Errorf("expected info record to be written after lowering the level, got %q", buf.String())
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	logger.Info("login",
+		"password", "hunter2",
+		"refresh_token", "abc",
+		"email", "john@example.com",
+		"error", errors.New("connect postgres://app:s3cret@db/app failed"),
+		"header", "Bearer eyJhbGciOiJIUzI1NiJ9.eyJ1c2VyX2lkIjoxfQ.sig",
+	)
+
+	record := decodeRecord(t, buf)
+	for key, want := range map[string]string{
+		"password":      Redacted,
+		"refresh_token": Redacted,
+		"email":         Redacted,
+		"error":         "connect postgres://app:" + Redacted + "@db/app failed",
+		"header":        "Bearer " + Redacted,
+	} {
+		if record[key] != want {
+			t.Errorf("expected %s to be %q, got %q", key, want, record[key])
+		}
+	}
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "john@example.com") || strings.Contains(buf.String(), "s3cret") {
+		t.Errorf("sensitive value leaked into %q", buf.String())
+	}
+}
+
+func TestWithAttrs(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	ctx := WithAttrs(context.Background(), slog.String("request_id", "req-1"))
+	ctx = WithAttrs(ctx, slog.Int64("user_id", 42))
+	logger.InfoContext(ctx, "hello")
+
+	record := decodeRecord(t, buf)
+	if record["request_id"] != "req-1" {
+		t.Errorf("expected request_id req-1, got %v", record["request_id"])
+	}
+	if record["user_id"] != float64(42) {
+		t.Errorf("expected user_id 42, got %v", record["user_id"])
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithUserID(r.Context(), 3)
+		logger.InfoContext(ctx, "handled")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+	handler := AccessLog(logger)(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(RequestIDHeader, "req-7")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "req-7" {
+		t.Errorf("expected the request ID to be echoed, got %q", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a handler line and an access line, got %q", buf.String())
+	}
+
+	var handled, access map[string]any
+	json.Unmarshal([]byte(lines[0]), &handled)
+	json.Unmarshal([]byte(lines[1]), &access)
+	for key, want := range map[string]any{"method": "GET", "route": "/users/{id}", "request_id": "req-7", "user_id": float64(3)} {
+		if handled[key] != want {
+			t.Errorf("expected handler line %s to be %v, got %v", key, want, handled[key])
+		}
+	}
+	for key, want := range map[string]any{
+		"msg":        "request",
+		"method":     "GET",
+		"route":      "/users/{id}",
+		"request_id": "req-7",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(5),
+		"client_ip":  "192.0.2.1",
+		"user_id":    float64(3),
+	} {
+		if access[key] != want {
+			t.Errorf("expected access line %s to be %v, got %v", key, want, access[key])
+		}
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("expected access line to report latency")
+	}
+}
+
+func TestAccessLog_GeneratesRequestID(t *testing.T) {
+	logger, _ := newTestLogger(t)
+
+	var seen string
+	handler := AccessLog(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	for _, header := range []string{"", "has space", strings.Repeat("a", maxRequestIDLength+1), "line\nbreak"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		got := w.Header().Get(RequestIDHeader)
+		if len(got) != 32 || got == header {
+			t.Errorf("expected a generated ID instead of %q, got %q", header, got)
+		}
+		if seen != got {
+			t.Errorf("expected the context to carry %q, got %q", got, seen)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader carries the ID clients and proxies assign to a request. It
+// is echoed in every response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds accepted request IDs, which clients control
+const maxRequestIDLength = 128
+
+// AccessLog returns a middleware that gives each request an ID, taken from
+// its X-Request-ID header when valid and generated otherwise, and logs one
+// access line per request to logger. It wraps the whole router, so requests
+// that match no route are logged too.
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	logger = OrDefault(logger)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			info := &requestInfo{id: requestID}
+			ctx := withRequestInfo(r.Context(), info)
+			ctx = WithAttrs(ctx, slog.String("request_id", requestID))
+			r = r.WithContext(ctx)
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", info.route),
+				slog.Int("status", rec.status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("client_ip", ClientIP(r)),
+			}
+			if info.userID != 0 {
+				attrs = append(attrs, slog.Int64("user_id", info.userID))
+			}
+			// The request ID is added from the context
+			logger.LogAttrs(ctx, slog.LevelInfo, "request", attrs...)
+		})
+	}
+}
+
+// Middleware adds the method and route template of each request to the
+// attributes logged with its context and records the route for AccessLog.
+// Install it with mux.Router.Use, which runs it after the route has been
+// matched.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attrs := []slog.Attr{slog.String("method", r.Method)}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				attrs = append(attrs, slog.String("route", template))
+				if info := requestInfoFrom(r.Context()); info != nil {
+					info.route = template
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithAttrs(r.Context(), attrs...)))
+	})
+}
+
+// validRequestID reports whether id can be used as is: non-empty, bounded
+// and made of printable ASCII without spaces, so it cannot forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ClientIP returns the address of the peer that sent r. Forwarding headers
+// are ignored, as any client can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder captures the status and body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces sensitive values in log records
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are substrings of attribute keys whose values are never
+// logged
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key", "apikey", "database_url", "dsn"}
+
+// Patterns of sensitive data inside otherwise loggable strings, such as
+// error messages
+var (
+	emailPattern       = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	jwtPattern         = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern      = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	urlPasswordPattern = regexp.MustCompile(`(://[^:/@\s]+):[^@\s]+@`)
+)
+
+// RedactString masks email addresses, JWTs, bearer tokens and passwords in
+// URLs found in s
+func RedactString(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}:"+Redacted+"@")
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+Redacted)
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	return emailPattern.ReplaceAllString(s, Redacted)
+}
+
+// redactAttr is the ReplaceAttr function of the handlers built by New. Values
+// of sensitive keys are dropped and strings and errors are scrubbed with
+// RedactString.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return a
+}
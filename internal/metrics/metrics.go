@@ -0,0 +1,92 @@
+// Package metrics defines the Prometheus metrics exported by the server on
+// /metrics. Metrics are registered with Registry rather than the global
+// Prometheus registry, so tests can read them without interference.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exported by Handler
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Outcomes used as the result label of the auth counters
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// Reasons a login fails, used as the reason label of LoginsTotal
+const (
+	ReasonUnknownEmail     = "unknown_email"
+	ReasonWrongPassword    = "wrong_password"
+	ReasonAccountSuspended = "account_suspended"
+)
+
+// UnmatchedRoute labels requests that match no route, so arbitrary paths
+// cannot create new series
+const UnmatchedRoute = "unmatched"
+
+var (
+	// HTTPRequestsTotal counts responses by method, route template and status
+	HTTPRequestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method, route template
+	// and status
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// LoginsTotal counts login attempts by result, with the reason of failures.
+	// Successful logins have an empty reason.
+	LoginsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	// TokenRefreshesTotal counts refresh token exchanges by result, with the
+	// problem code of failures as the reason
+	TokenRefreshesTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_refreshes_total",
+		Help: "Refresh token exchanges by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	// RefreshTokenReuseTotal counts refresh tokens presented for a user that
+	// do not match the user's current token, such as a token that was
+	// already exchanged
+	RefreshTokenReuseTotal = factory.NewCounter(prometheus.CounterOpts{
+		Name: "auth_refresh_token_reuse_total",
+		Help: "Refresh tokens presented that do not match the user's current token.",
+	})
+
+	// RateLimitRejectionsTotal counts requests rejected by the rate limiter by
+	// route template
+	RateLimitRejectionsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter by route template.",
+	}, []string{"route"})
+)
+
+// Handler serves the metrics in Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
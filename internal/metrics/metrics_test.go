@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.NotFoundHandler = Middleware(http.NotFoundHandler())
+	router.HandleFunc("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	found := HTTPRequestsTotal.WithLabelValues("GET", "/widgets/{id}", "202")
+	unmatched := HTTPRequestsTotal.WithLabelValues("GET", UnmatchedRoute, "404")
+	foundBefore, unmatchedBefore := testutil.ToFloat64(found), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/widgets/1", "/widgets/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if got := testutil.ToFloat64(found) - foundBefore; got != 2 {
+		t.Errorf("expected 2 requests to the widget route, got %v", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - unmatchedBefore; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	LoginsTotal.WithLabelValues(ResultFailed, ReasonWrongPassword).Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`auth_logins_total{reason="wrong_password",result="failed"}`, "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the exposition", want)
+		}
+	}
+}
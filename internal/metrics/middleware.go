@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Middleware counts and times each request by method, route template and
+// status. Install it with mux.Router.Use, which runs it after the route has
+// been matched, and wrap the router's NotFoundHandler and
+// MethodNotAllowedHandler with it, which Use does not reach.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		labels := []string{r.Method, RouteTemplate(r), strconv.Itoa(rec.status)}
+		HTTPRequestsTotal.WithLabelValues(labels...).Inc()
+		HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RouteTemplate returns the template of the route r matched, or
+// UnmatchedRoute
+func RouteTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return UnmatchedRoute
+}
+
+// statusRecorder captures the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
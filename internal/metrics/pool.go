@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbUp              = prometheus.NewDesc("db_up", "Whether the last background ping of the database succeeded (1) or not (0).", nil, nil)
+	poolAcquiredConns = prometheus.NewDesc("db_pool_acquired_conns", "Connections currently acquired from the pool.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc("db_pool_idle_conns", "Idle connections in the pool.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc("db_pool_total_conns", "Connections in the pool, acquired, idle or being established.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc("db_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquiresTotal = prometheus.NewDesc("db_pool_acquires_total", "Successful acquires from the pool.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc("db_pool_empty_acquires_total", "Acquires that had to wait for a connection because none was idle.", nil, nil)
+	poolAcquireWait   = prometheus.NewDesc("db_pool_acquire_wait_seconds_total", "Total time spent waiting for successful acquires.", nil, nil)
+)
+
+// poolCollector reports the statistics of a pgxpool.Pool and the health of
+// its database on every scrape
+type poolCollector struct {
+	stat    func() *pgxpool.Stat
+	healthy func() bool
+}
+
+// NewPoolCollector returns a collector exporting the statistics returned by
+// stat, such as the Stat method of a pgxpool.Pool, and the database health
+// reported by healthy
+func NewPoolCollector(stat func() *pgxpool.Stat, healthy func() bool) prometheus.Collector {
+	return poolCollector{stat: stat, healthy: healthy}
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{dbUp, poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns, poolAcquiresTotal, poolEmptyAcquires, poolAcquireWait} {
+		ch <- desc
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	up := 0.0
+	if c.healthy() {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(dbUp, prometheus.GaugeValue, up)
+
+	stat := c.stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresTotal, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
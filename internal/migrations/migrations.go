@@ -0,0 +1,390 @@
+// Package migrations applies the numbered, embedded SQL schema migrations for
+// the Postgres and SQLite backends and records them in schema_migrations.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Supported dialects, named after the directory holding their migrations.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// advisoryLockKey identifies the Postgres advisory lock held while migrating,
+// so replicas starting at the same time apply each migration only once.
+const advisoryLockKey int64 = 7265746179
+
+var (
+	fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	namePattern     = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration is a single numbered schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations for one dialect to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns a Migrator for db using the embedded migrations of dialect.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	sub, err := fs.Sub(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("unknown migration dialect %q: %w", dialect, err)
+	}
+
+	migrations, err := load(sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("unknown migration dialect %q", dialect)
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// load reads and pairs the up and down files found in fsys.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns the ones applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.session(ctx, true, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			record := fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)", m.placeholder(1), m.placeholder(2), m.placeholder(3))
+			err := m.inTx(ctx, conn, migration.up, record, migration.Version, migration.Name, m.now())
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the most recently applied migrations, at most steps of them,
+// and returns the ones reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.session(ctx, true, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+
+			record := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %s", m.placeholder(1))
+			if err := m.inTx(ctx, conn, migration.down, record, migration.Version); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration with the time it was applied, if any.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.session(ctx, false, func(conn *sql.Conn) error {
+		// Without the tracking table nothing has been applied yet
+		done := map[int64]time.Time{}
+		exists, err := m.trackingTableExists(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if done, err = m.appliedVersions(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := done[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Pending returns the number of migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// session runs fn on a dedicated connection. When exclusive is set it first
+// makes sure the tracking table exists and, on Postgres, holds an advisory
+// lock for the duration, which blocks other migrators until fn returns.
+// Other sessions only read, so they work for read-only roles and take no
+// catalog locks.
+func (m *Migrator) session(ctx context.Context, exclusive bool, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if !exclusive {
+		return fn(conn)
+	}
+
+	if m.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+	}
+
+	createTable := `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+	if m.dialect == SQLite {
+		createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TEXT NOT NULL
+)`
+	}
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// trackingTableExists reports whether schema_migrations has been created
+func (m *Migrator) trackingTableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	if m.dialect == SQLite {
+		query = `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	}
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	return exists, nil
+}
+
+// appliedVersions maps each applied version to the time it was applied.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt any
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+
+		switch v := appliedAt.(type) {
+		case time.Time:
+			applied[version] = v
+		case string:
+			applied[version], _ = time.Parse(time.RFC3339Nano, v)
+		default:
+			applied[version] = time.Time{}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return applied, nil
+}
+
+// inTx runs script and the bookkeeping statement in one transaction.
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) placeholder(n int) string {
+	if m.dialect == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// now returns the applied_at value in the representation of the dialect.
+func (m *Migrator) now() any {
+	if m.dialect == SQLite {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	return time.Now()
+}
+
+// Create writes empty up and down files for a new migration to the postgres
+// and sqlite directories under dir, numbered after the highest existing
+// version. It returns the paths written.
+func Create(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name %q: use letters, digits and underscores", name)
+	}
+
+	var next int64 = 1
+	for _, dialect := range []string{Postgres, SQLite} {
+		existing, err := load(os.DirFS(filepath.Join(dir, dialect)))
+		if err != nil {
+			return nil, err
+		}
+		if n := len(existing); n > 0 && existing[n-1].Version >= next {
+			next = existing[n-1].Version + 1
+		}
+	}
+
+	var paths []string
+	for _, dialect := range []string{Postgres, SQLite} {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			content := fmt.Sprintf("-- %s migration %04d_%s (%s)\n", dialect, next, name, direction)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return paths, fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,147 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	migrator, err := New(openTestDB(t), SQLite)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrator.migrations), len(applied))
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Up should be a no-op, got %d applied, err %v", len(applied), err)
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || pending != 0 {
+		t.Fatalf("expected no pending migrations, got %d, err %v", pending, err)
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 {
+		t.Fatalf("expected one migration reverted, got %d, err %v", len(reverted), err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	last := statuses[len(statuses)-1]
+	if last.AppliedAt != nil {
+		t.Fatalf("reverted migration %d is still marked applied", last.Version)
+	}
+
+	// Every down migration reverts cleanly and the schema can be rebuilt
+	reverted, err = migrator.Down(ctx, len(migrator.migrations))
+	if err != nil || len(reverted) != len(migrator.migrations)-1 {
+		t.Fatalf("expected remaining migrations reverted, got %d, err %v", len(reverted), err)
+	}
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != len(migrator.migrations) {
+		t.Fatalf("expected all migrations reapplied, got %d, err %v", len(applied), err)
+	}
+}
+
+func TestPostgresAndSQLiteMigrationsMatch(t *testing.T) {
+	pg, err := load(mustSub(t, Postgres))
+	if err != nil {
+		t.Fatalf("failed to load postgres migrations: %v", err)
+	}
+	lite, err := load(mustSub(t, SQLite))
+	if err != nil {
+		t.Fatalf("failed to load sqlite migrations: %v", err)
+	}
+
+	if len(pg) != len(lite) {
+		t.Fatalf("postgres has %d migrations, sqlite has %d", len(pg), len(lite))
+	}
+	for i := range pg {
+		if pg[i].Version != lite[i].Version || pg[i].Name != lite[i].Name {
+			t.Fatalf("migration %d_%s has no sqlite counterpart", pg[i].Version, pg[i].Name)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, dialect := range []string{Postgres, SQLite} {
+		os.MkdirAll(filepath.Join(dir, dialect), 0o755)
+		os.WriteFile(filepath.Join(dir, dialect, "0007_existing.up.sql"), []byte("SELECT 1;"), 0o644)
+	}
+
+	paths, err := Create(dir, "Add Widgets")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(paths) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(paths))
+	}
+	if filepath.Base(paths[0]) != "0008_add_widgets.up.sql" {
+		t.Fatalf("unexpected file name %s", paths[0])
+	}
+
+	if _, err := Create(dir, "bad-name!"); err == nil {
+		t.Fatalf("Create accepted an invalid name")
+	}
+}
+
+func mustSub(t *testing.T, dialect string) fs.FS {
+	t.Helper()
+	sub, err := fs.Sub(files, dialect)
+	if err != nil {
+		t.Fatalf("fs.Sub failed: %v", err)
+	}
+	return sub
+}
+
+func TestPendingIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator, err := New(db, SQLite)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || pending != len(migrator.migrations) {
+		t.Fatalf("expected all %d migrations pending, got %d, err %v", len(migrator.migrations), pending, err)
+	}
+
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`).Scan(&tables); err != nil {
+		t.Fatalf("failed to query sqlite_master: %v", err)
+	}
+	if tables != 0 {
+		t.Error("expected Pending not to create schema_migrations")
+	}
+}
@@ -0,0 +1,8 @@
+-- Keyset pagination on GET /users orders by (created_at, id), optionally
+-- filtered by status. Sorting by email uses the unique index on email.
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS users_status_created_at_id_idx ON users (status, created_at, id);
+
+-- email_contains is a case-insensitive substring match, which needs trigrams.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING gin (email gin_trgm_ops);
@@ -0,0 +1,6 @@
+-- Trigram indexes for GET /users/search, which matches substrings and
+-- misspellings of names, emails and phone numbers. The email index was
+-- created with the listing indexes.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx ON users USING gin ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_phone_number_trgm_idx ON users USING gin (phone_number gin_trgm_ops);
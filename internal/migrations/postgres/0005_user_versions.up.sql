@@ -0,0 +1,3 @@
+-- Row version for optimistic concurrency; every update increments it and
+-- the API exposes it as the ETag of the user.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Deleted users are kept, hidden from the API, until the purge job removes
+-- them after the retention period.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Every status change made by an admin, with the reason given and who made
+-- it. changed_by is kept as NULL once the admin is purged.
+CREATE TABLE IF NOT EXISTS user_status_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_status VARCHAR(16) NOT NULL,
+    new_status VARCHAR(16) NOT NULL CHECK (new_status IN ('active', 'inactive', 'banned')),
+    reason VARCHAR(500) NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS user_status_changes_user_id_idx ON user_status_changes (user_id, id);
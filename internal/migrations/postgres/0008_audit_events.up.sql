@@ -0,0 +1,31 @@
+-- Append-only log of security-relevant events. Each row stores the hash of
+-- the row before it; prev_hash is unique so concurrent appends cannot fork
+-- the chain. actor_id and target_id are not foreign keys, so events outlive
+-- purged users. diff is JSON rather than JSONB to keep the exact text the
+-- hash was computed over.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    actor_id BIGINT,
+    target_id BIGINT,
+    action VARCHAR(64) NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    request_id VARCHAR(128) NOT NULL,
+    diff JSON,
+    prev_hash VARCHAR(64) NOT NULL UNIQUE,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,22 @@
+-- SQLite equivalent of postgres/0001_init.up.sql. VARCHAR limits are enforced with CHECK
+-- constraints because SQLite does not apply declared lengths. Timestamps are
+-- stored as fixed-width UTC text so they sort chronologically.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name TEXT NOT NULL CHECK (length(first_name) <= 20),
+    last_name TEXT NOT NULL CHECK (length(last_name) <= 20),
+    phone_number TEXT UNIQUE NOT NULL CHECK (length(phone_number) <= 20),
+    email TEXT UNIQUE NOT NULL CHECK (length(email) <= 100),
+    password_hash TEXT NOT NULL CHECK (length(password_hash) <= 255),
+    status TEXT NOT NULL CHECK (status IN ('active', 'inactive', 'banned')),
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT UNIQUE NOT NULL CHECK (length(token) <= 255),
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
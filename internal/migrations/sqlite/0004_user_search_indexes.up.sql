@@ -0,0 +1,3 @@
+-- SQLite has no trigram indexes; GET /users/search falls back to LIKE
+-- substring matching, so there is nothing to create.
+SELECT 1;
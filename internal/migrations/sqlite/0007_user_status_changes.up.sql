@@ -0,0 +1,12 @@
+-- Every status change made by an admin, with the reason given and who made
+-- it. changed_by is kept as NULL once the admin is purged.
+CREATE TABLE IF NOT EXISTS user_status_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_status TEXT NOT NULL,
+    new_status TEXT NOT NULL CHECK (new_status IN ('active', 'inactive', 'banned')),
+    reason TEXT NOT NULL CHECK (length(reason) <= 500),
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_status_changes_user_id_idx ON user_status_changes (user_id, id);
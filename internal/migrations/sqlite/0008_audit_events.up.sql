@@ -0,0 +1,29 @@
+-- Append-only log of security-relevant events. Each row stores the hash of
+-- the row before it; prev_hash is unique so the chain cannot fork. actor_id
+-- and target_id are not foreign keys, so events outlive purged users.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TEXT NOT NULL,
+    actor_id INTEGER,
+    target_id INTEGER,
+    action TEXT NOT NULL CHECK (length(action) <= 64),
+    ip TEXT NOT NULL CHECK (length(ip) <= 64),
+    user_agent TEXT NOT NULL CHECK (length(user_agent) <= 512),
+    request_id TEXT NOT NULL CHECK (length(request_id) <= 128),
+    diff TEXT,
+    prev_hash TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
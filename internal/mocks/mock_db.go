@@ -1,24 +1,39 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
 	"github.com/stretchr/testify/mock"
 )
 
-// MockDB is a mock type for the UserDBInterface type
+// MockDB is a mock type for the models.Store interface. The context argument
+// is not part of the recorded calls, so expectations are set without it.
 type MockDB struct {
 	mock.Mock
 }
 
-func (m *MockDB) GetAllUsers() ([]*models.User, error) {
-	args := m.Called()
+var _ models.Store = (*MockDB)(nil)
+
+func (m *MockDB) ListUsers(ctx context.Context, params models.UserListParams) (*models.UserPage, error) {
+	args := m.Called(params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserPage), args.Error(1)
+}
+
+func (m *MockDB) SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserSearchPage, error) {
+	args := m.Called(params)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]*models.User), args.Error(1)
+	return args.Get(0).(*models.UserSearchPage), args.Error(1)
 }
 
-func (m *MockDB) GetUserByID(id int64) (*models.User, error) {
+func (m *MockDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -26,7 +41,7 @@ func (m *MockDB) GetUserByID(id int64) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockDB) GetUserByEmail(email string) (*models.User, error) {
+func (m *MockDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	args := m.Called(email)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -34,27 +49,50 @@ func (m *MockDB) GetUserByEmail(email string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockDB) RegisterUser(user *models.User) error {
+func (m *MockDB) RegisterUser(ctx context.Context, user *models.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockDB) UpdateUser(user *models.User) error {
+func (m *MockDB) UpdateUser(ctx context.Context, user *models.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *MockDB) DeleteUser(id int64) error {
+func (m *MockDB) DeleteUser(ctx context.Context, id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDB) RestoreUser(ctx context.Context, id int64) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
-func (m *MockDB) CreateRefreshToken(refreshToken *models.RefreshToken) error {
+func (m *MockDB) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDB) ChangeUserStatus(ctx context.Context, change *models.UserStatusChange) error {
+	args := m.Called(change)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListUserStatusChanges(ctx context.Context, userID int64) ([]*models.UserStatusChange, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserStatusChange), args.Error(1)
+}
+
+func (m *MockDB) CreateRefreshToken(ctx context.Context, refreshToken *models.RefreshToken) error {
 	args := m.Called(refreshToken)
 	return args.Error(0)
 }
 
-func (m *MockDB) GetRefreshToken(userID int64) (*models.RefreshToken, error) {
+func (m *MockDB) GetRefreshToken(ctx context.Context, userID int64) (*models.RefreshToken, error) {
 	args := m.Called(userID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -62,7 +100,26 @@ func (m *MockDB) GetRefreshToken(userID int64) (*models.RefreshToken, error) {
 	return args.Get(0).(*models.RefreshToken), args.Error(1)
 }
 
-func (m *MockDB) DeleteRefreshToken(userID int64) error {
+func (m *MockDB) DeleteRefreshToken(ctx context.Context, userID int64) error {
 	args := m.Called(userID)
 	return args.Error(0)
 }
+
+// WithTx runs fn against the mock itself, so calls made inside the
+// transaction are matched against the same expectations.
+func (m *MockDB) WithTx(ctx context.Context, fn func(tx models.Store) error) error {
+	return fn(m)
+}
+
+func (m *MockDB) AppendAuditEvent(ctx context.Context, event *audit.Event) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListAuditEvents(ctx context.Context, filter audit.Filter) (*audit.Page, error) {
+	args := m.Called(filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*audit.Page), args.Error(1)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+)
+
+// auditEventColumns are the columns read by ListAuditEvents, in Scan order.
+// Missing actors and targets are stored as NULL and read back as zero.
+const auditEventColumns = `id, occurred_at, COALESCE(actor_id, 0), COALESCE(target_id, 0), action, ip, user_agent, request_id, diff, prev_hash, hash`
+
+// auditEventListSQL renders the WHERE, ORDER BY and LIMIT clauses of a
+// ListAuditEvents query for a filter that went through WithDefaults. Events
+// are returned newest first. placeholder renders the n-th bind parameter and
+// timeArg converts timestamps to the representation the database stores.
+func auditEventListSQL(f audit.Filter, placeholder func(n int) string, timeArg func(time.Time) any) (string, []any) {
+	var conds []string
+	var args []any
+	bind := func(v any) string {
+		args = append(args, v)
+		return placeholder(len(args))
+	}
+
+	if f.ActorID != 0 {
+		conds = append(conds, "actor_id = "+bind(f.ActorID))
+	}
+	if f.TargetID != 0 {
+		conds = append(conds, "target_id = "+bind(f.TargetID))
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = "+bind(f.Action))
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "occurred_at >= "+bind(timeArg(f.Since)))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "occurred_at < "+bind(timeArg(f.Until)))
+	}
+	if f.BeforeID != 0 {
+		conds = append(conds, "id < "+bind(f.BeforeID))
+	}
+
+	var sql strings.Builder
+	if len(conds) > 0 {
+		sql.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	}
+	sql.WriteString(" ORDER BY id DESC LIMIT " + bind(f.Limit+1))
+
+	return sql.String(), args
+}
+
+// auditDiffArg returns the value stored in the diff column: the JSON text,
+// or NULL for events without a diff.
+func auditDiffArg(diff json.RawMessage) any {
+	if len(diff) == 0 {
+		return nil
+	}
+	return string(diff)
+}
@@ -0,0 +1,587 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryStore is an in-process implementation of Store for development and
+// tests. It enforces the same constraints as the SQL schema: column lengths,
+// unique email, phone number and refresh token, the status check, and
+// cascading refresh token deletes when a user is removed.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[int64]*User
+	refreshTokens map[int64]*RefreshToken
+	deletedAt     map[int64]time.Time // soft deleted users
+	statusChanges []*UserStatusChange
+	auditEvents   []*audit.Event // oldest first; an event's ID is its index plus one
+	nextUserID    int64
+	nextTokenID   int64
+	nextChangeID  int64
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[int64]*User),
+		refreshTokens: make(map[int64]*RefreshToken),
+		deletedAt:     make(map[int64]time.Time),
+	}
+}
+
+// WithTx runs fn against a private copy of the store while holding the store
+// lock, so other callers wait for it to finish. The copy replaces the store's
+// contents when fn returns nil and is discarded otherwise.
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.cloneLocked()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	s.users = tx.users
+	s.refreshTokens = tx.refreshTokens
+	s.deletedAt = tx.deletedAt
+	s.statusChanges = tx.statusChanges
+	s.auditEvents = tx.auditEvents
+	s.nextUserID = tx.nextUserID
+	s.nextTokenID = tx.nextTokenID
+	s.nextChangeID = tx.nextChangeID
+
+	return nil
+}
+
+// cloneLocked returns a deep copy of the store
+func (s *MemoryStore) cloneLocked() *MemoryStore {
+	c := NewMemoryStore()
+	for id, user := range s.users {
+		c.users[id] = copyUser(user, true)
+	}
+	for id, rt := range s.refreshTokens {
+		copied := *rt
+		c.refreshTokens[id] = &copied
+	}
+	for id, deletedAt := range s.deletedAt {
+		c.deletedAt[id] = deletedAt
+	}
+	for _, change := range s.statusChanges {
+		copied := *change
+		c.statusChanges = append(c.statusChanges, &copied)
+	}
+	// Events are never modified, so the copy can share them
+	c.auditEvents = slices.Clone(s.auditEvents)
+	c.nextUserID = s.nextUserID
+	c.nextTokenID = s.nextTokenID
+	c.nextChangeID = s.nextChangeID
+
+	return c
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email && !s.isDeletedLocked(user.ID) {
+			return copyUser(user, true), nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to get user by email: %w", ErrNotFound)
+}
+
+// RegisterUser stores a new user with a hashed password
+func (s *MemoryStore) RegisterUser(ctx context.Context, user *User) error {
+	if !IsValidStatus(user.Status) {
+		user.Status = StatusActive // Default to active if invalid
+	}
+	if !IsValidRole(user.Role) {
+		user.Role = RoleUser
+	}
+	hashedPassword, err := tracing.GenerateFromPassword(ctx, []byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkUserColumns(user); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := s.checkUniqueLocked(user, 0); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	s.nextUserID++
+	now := time.Now()
+	user.ID = s.nextUserID
+	user.PasswordHash = string(hashedPassword)
+	user.Version = 1
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := copyUser(user, true)
+	stored.Password = ""
+	s.users[stored.ID] = stored
+
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (s *MemoryStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok || s.isDeletedLocked(id) {
+		return nil, fmt.Errorf("failed to get user by id: %w", ErrNotFound)
+	}
+
+	return copyUser(user, false), nil
+}
+
+// ListUsers retrieves one page of users matching params
+func (s *MemoryStore) ListUsers(ctx context.Context, params UserListParams) (*UserPage, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	var after time.Time
+	if params.Cursor != nil && params.SortField == SortByCreatedAt {
+		if after, err = time.Parse(time.RFC3339Nano, params.Cursor.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// compare orders two users by the requested sort, ties broken by id
+	compare := func(a, b *User) int {
+		c := 0
+		switch params.SortField {
+		case SortByCreatedAt:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case SortByEmail:
+			c = strings.Compare(a.Email, b.Email)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if params.SortDesc {
+			c = -c
+		}
+		return c
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*User
+	for _, user := range s.users {
+		if s.isDeletedLocked(user.ID) {
+			continue
+		}
+		if params.Status != "" && user.Status != params.Status {
+			continue
+		}
+		if params.EmailContains != "" && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(params.EmailContains)) {
+			continue
+		}
+		if !params.CreatedAfter.IsZero() && !user.CreatedAt.After(params.CreatedAfter) {
+			continue
+		}
+		if c := params.Cursor; c != nil && compare(user, &User{ID: c.ID, Email: c.Value, CreatedAt: after}) <= 0 {
+			continue
+		}
+		users = append(users, copyUser(user, false))
+	}
+	slices.SortFunc(users, compare)
+
+	if len(users) > params.Limit+1 {
+		users = users[:params.Limit+1]
+	}
+
+	return newUserPage(users, params), nil
+}
+
+// SearchUsers ranks users by case-insensitive substring matches of the query
+// in their name, email and phone number. There is no fuzzy matching.
+func (s *MemoryStore) SearchUsers(ctx context.Context, params UserSearchParams) (*UserSearchPage, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		user *User
+		rank float64
+	}
+
+	s.mu.RLock()
+	var hits []hit
+	for _, user := range s.users {
+		if s.isDeletedLocked(user.ID) {
+			continue
+		}
+		rank := 0.0
+		for _, value := range searchableValues(user) {
+			rank = max(rank, substringRank(value, params.Query))
+		}
+		if rank > 0 {
+			hits = append(hits, hit{copyUser(user, false), rank})
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(hits, func(a, b hit) int {
+		if c := cmp.Compare(b.rank, a.rank); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.user.ID, b.user.ID)
+	})
+
+	hits = hits[min(params.Offset, len(hits)):]
+	hits = hits[:min(params.Limit+1, len(hits))]
+
+	users := make([]*User, len(hits))
+	ranks := make([]float64, len(hits))
+	for i, h := range hits {
+		users[i], ranks[i] = h.user, h.rank
+	}
+
+	return newUserSearchPage(users, ranks, params), nil
+}
+
+// UpdateUser updates an existing user's information, bumps its updated_at and
+// increments its version. When user.Version is set, the update only applies
+// to that version and fails with ErrVersionConflict otherwise. Updating a
+// missing user fails with ErrNotFound.
+func (s *MemoryStore) UpdateUser(ctx context.Context, user *User) error {
+	if !IsValidStatus(user.Status) {
+		return fmt.Errorf("failed to update user: %w", ErrInvalidValue)
+	}
+	if !IsValidRole(user.Role) {
+		return fmt.Errorf("failed to update user: %w", ErrInvalidValue)
+	}
+	if err := checkUserColumns(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.ID]
+	if !ok || s.isDeletedLocked(user.ID) {
+		return fmt.Errorf("failed to update user: %w", ErrNotFound)
+	}
+	if user.Version != 0 && user.Version != stored.Version {
+		return fmt.Errorf("failed to update user: %w", ErrVersionConflict)
+	}
+	if err := s.checkUniqueLocked(user, user.ID); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.PhoneNumber = user.PhoneNumber
+	stored.Email = user.Email
+	stored.Status = user.Status
+	stored.Role = user.Role
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	user.UpdatedAt = stored.UpdatedAt
+	user.Version = stored.Version
+
+	return nil
+}
+
+// DeleteUser soft deletes a user by ID: the user is hidden from every read
+// until restored or purged, and their refresh tokens are revoked. It returns
+// ErrNotFound if there is no user with that ID that is not already deleted.
+func (s *MemoryStore) DeleteUser(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[id]
+	if !ok || s.isDeletedLocked(id) {
+		return fmt.Errorf("failed to delete user: %w", ErrNotFound)
+	}
+
+	now := time.Now()
+	s.deletedAt[id] = now
+	stored.UpdatedAt = now
+	stored.Version++
+	s.deleteRefreshTokensLocked(id)
+
+	return nil
+}
+
+// RestoreUser undoes the soft delete of a user. It returns ErrUserNotDeleted
+// if there is no deleted user with that ID.
+func (s *MemoryStore) RestoreUser(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isDeletedLocked(id) {
+		return fmt.Errorf("failed to restore user: %w", ErrUserNotDeleted)
+	}
+
+	stored := s.users[id]
+	delete(s.deletedAt, id)
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently deletes the users soft deleted before the
+// given time and returns how many were removed.
+func (s *MemoryStore) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, deletedAt := range s.deletedAt {
+		if deletedAt.Before(before) {
+			delete(s.users, id)
+			delete(s.deletedAt, id)
+			s.deleteRefreshTokensLocked(id)
+			purged++
+		}
+	}
+
+	// Like the foreign keys of user_status_changes: the history of a purged
+	// user goes with it, and changes made by a purged admin lose the actor
+	kept := s.statusChanges[:0]
+	for _, change := range s.statusChanges {
+		if _, ok := s.users[change.UserID]; !ok {
+			continue
+		}
+		if _, ok := s.users[change.ChangedBy]; !ok {
+			change.ChangedBy = 0
+		}
+		kept = append(kept, change)
+	}
+	s.statusChanges = kept
+
+	return purged, nil
+}
+
+// ChangeUserStatus sets the status of a user, records the change and revokes
+// the user's refresh tokens unless the new status is active.
+func (s *MemoryStore) ChangeUserStatus(ctx context.Context, change *UserStatusChange) error {
+	if !IsValidStatus(change.NewStatus) || utf8.RuneCountInString(change.Reason) > MaxStatusReasonLength {
+		return fmt.Errorf("failed to change user status: %w", ErrInvalidValue)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[change.UserID]
+	if !ok || s.isDeletedLocked(change.UserID) {
+		return fmt.Errorf("failed to change user status: %w", ErrNotFound)
+	}
+
+	now := time.Now()
+	s.nextChangeID++
+	change.ID = s.nextChangeID
+	change.OldStatus = stored.Status
+	change.CreatedAt = now
+	recorded := *change
+	s.statusChanges = append(s.statusChanges, &recorded)
+
+	stored.Status = change.NewStatus
+	stored.UpdatedAt = now
+	stored.Version++
+	if change.NewStatus != StatusActive {
+		s.deleteRefreshTokensLocked(change.UserID)
+	}
+
+	return nil
+}
+
+// ListUserStatusChanges returns the status changes of a user, newest first
+func (s *MemoryStore) ListUserStatusChanges(ctx context.Context, userID int64) ([]*UserStatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	changes := []*UserStatusChange{}
+	for i := len(s.statusChanges) - 1; i >= 0; i-- {
+		if s.statusChanges[i].UserID == userID {
+			copied := *s.statusChanges[i]
+			changes = append(changes, &copied)
+		}
+	}
+
+	return changes, nil
+}
+
+// AppendAuditEvent seals event against the newest stored event and appends it
+func (s *MemoryStore) AppendAuditEvent(ctx context.Context, event *audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevHash := ""
+	if n := len(s.auditEvents); n > 0 {
+		prevHash = s.auditEvents[n-1].Hash
+	}
+	event.Seal(prevHash, time.Now())
+	event.ID = int64(len(s.auditEvents)) + 1
+
+	recorded := *event
+	s.auditEvents = append(s.auditEvents, &recorded)
+
+	return nil
+}
+
+// ListAuditEvents returns one page of audit events matching filter, newest
+// first
+func (s *MemoryStore) ListAuditEvents(ctx context.Context, filter audit.Filter) (*audit.Page, error) {
+	filter = filter.WithDefaults()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []*audit.Event
+	for i := len(s.auditEvents) - 1; i >= 0 && len(events) <= filter.Limit; i-- {
+		if filter.Matches(s.auditEvents[i]) {
+			copied := *s.auditEvents[i]
+			events = append(events, &copied)
+		}
+	}
+
+	return audit.NewPage(events, filter), nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[rt.UserID]; !ok {
+		return fmt.Errorf("failed to create refresh token: %w", ErrNotFound)
+	}
+	for _, existing := range s.refreshTokens {
+		if existing.Token == rt.Token {
+			return fmt.Errorf("failed to create refresh token: %w", ErrDuplicate)
+		}
+	}
+
+	s.nextTokenID++
+	rt.ID = s.nextTokenID
+	stored := *rt
+	s.refreshTokens[stored.ID] = &stored
+
+	return nil
+}
+
+// GetRefreshToken returns the newest unexpired refresh token of a user
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, userID int64) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *RefreshToken
+	now := time.Now()
+	for _, rt := range s.refreshTokens {
+		if rt.UserID != userID || !rt.ExpiresAt.After(now) {
+			continue
+		}
+		if latest == nil || rt.ID > latest.ID {
+			latest = rt
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", ErrNotFound)
+	}
+
+	rt := *latest
+	return &rt, nil
+}
+
+// DeleteRefreshToken deletes all refresh tokens of a user
+func (s *MemoryStore) DeleteRefreshToken(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteRefreshTokensLocked(userID)
+
+	return nil
+}
+
+// checkUniqueLocked enforces the unique email and phone number constraints
+// against every stored user except the one with id skipID.
+func (s *MemoryStore) checkUniqueLocked(user *User, skipID int64) error {
+	for _, existing := range s.users {
+		if existing.ID == skipID {
+			continue
+		}
+		if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+		if existing.PhoneNumber == user.PhoneNumber {
+			return ErrDuplicatePhone
+		}
+	}
+
+	return nil
+}
+
+// checkUserColumns enforces the VARCHAR limits of the users table.
+func checkUserColumns(user *User) error {
+	if utf8.RuneCountInString(user.FirstName) > 20 ||
+		utf8.RuneCountInString(user.LastName) > 20 ||
+		utf8.RuneCountInString(user.PhoneNumber) > 20 ||
+		utf8.RuneCountInString(user.Email) > 100 {
+		return ErrInvalidValue
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) deleteRefreshTokensLocked(userID int64) {
+	for id, rt := range s.refreshTokens {
+		if rt.UserID == userID {
+			delete(s.refreshTokens, id)
+		}
+	}
+}
+
+// isDeletedLocked reports whether the user with the given ID is soft deleted
+func (s *MemoryStore) isDeletedLocked(id int64) bool {
+	_, deleted := s.deletedAt[id]
+	return deleted
+}
+
+// searchableValues returns the values of user that SearchUsers matches
+func searchableValues(user *User) []string {
+	return []string{user.FirstName, user.LastName, user.FirstName + " " + user.LastName, user.Email, user.PhoneNumber}
+}
+
+// copyUser returns a detached copy of user. The password hash is only kept
+// when withHash is set, matching the columns the Postgres queries select.
+func copyUser(user *User, withHash bool) *User {
+	c := *user
+	if !withHash {
+		c.PasswordHash = ""
+	}
+	return &c
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+)
+
+type primaryKey struct{}
+
+// WithPrimary returns a copy of ctx whose reads go to the primary database
+// even when read replicas are configured. Use it for reads that must see the
+// caller's own writes or that a write will be based on. Backends without
+// replicas ignore it.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// PrimaryRequested reports whether ctx was marked by WithPrimary
+func PrimaryRequested(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// readDB returns the querier for reads that tolerate replication lag: the
+// transaction the user was bound to by WithTx, the primary when ctx asks for
+// it, or otherwise a read replica
+func (u *User) readDB(ctx context.Context) querier {
+	if (u != nil && u.tx != nil) || PrimaryRequested(ctx) {
+		return u.db()
+	}
+	return config.DbConn.ReadPool()
+}
@@ -0,0 +1,596 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/migrations"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite" // also registers the pure-Go "sqlite" driver
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteTimeLayout is fixed width and UTC so stored timestamps compare
+// correctly as text. Microsecond precision matches Postgres TIMESTAMPTZ.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// SQLiteStore is a Store backed by a SQLite database file, for small
+// single-node deployments and demos.
+type SQLiteStore struct {
+	db     *sql.DB
+	q      sqliteQuerier // db, or the transaction started by WithTx
+	logger *slog.Logger
+}
+
+// sqliteQuerier is the subset of *sql.DB and *sql.Tx used by the queries below
+type sqliteQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NewSQLiteStore opens the database described by a sqlite:// URL and applies
+// any pending migrations. It logs to logger, or to the default logger when it
+// is nil.
+func NewSQLiteStore(databaseURL string, logger *slog.Logger) (*SQLiteStore, error) {
+	db, err := OpenSQLiteDB(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SQLiteStore{db: db, q: db, logger: logging.OrDefault(logger)}
+	if err := store.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// OpenSQLiteDB opens the database described by a sqlite:// URL, e.g.
+// sqlite://data/app.db, sqlite:///var/lib/app.db or sqlite://:memory:, with
+// foreign keys enforced. The schema is left untouched.
+func OpenSQLiteDB(databaseURL string) (*sql.DB, error) {
+	path, ok := strings.CutPrefix(databaseURL, "sqlite://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("invalid sqlite database URL %q", databaseURL)
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	dsn := path + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer, and every connection to :memory: is a
+	// separate database, so all queries share one connection.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// DB returns the underlying database handle, for health checks and the
+// schema migrations
+func (s *SQLiteStore) DB() *sql.DB {
+	return s.db
+}
+
+// migrate applies the pending embedded SQLite migrations.
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	migrator, err := migrations.New(s.db, migrations.SQLite)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate sqlite database: %w", err)
+	}
+	if len(applied) > 0 {
+		s.logger.InfoContext(ctx, "applied sqlite migrations", "count", len(applied))
+	}
+
+	return nil
+}
+
+// WithTx runs fn in a transaction. The Store passed to fn is bound to it; the
+// transaction commits when fn returns nil and rolls back otherwise. SQLite
+// serializes writers, so there are no serialization failures to retry.
+// Calling WithTx on a Store that is already in a transaction reuses it.
+func (s *SQLiteStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if _, inTx := s.q.(*sql.Tx); inTx {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(&SQLiteStore{db: s.db, q: tx, logger: s.logger}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT id, first_name, last_name, phone_number, email, password_hash, status, role, version, created_at, updated_at FROM users WHERE email = ? AND deleted_at IS NULL`
+	user := &User{}
+	var createdAt, updatedAt string
+
+	err := s.q.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.PasswordHash, &user.Status, &user.Role, &user.Version, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", sqliteStoreError(err))
+	}
+	if err := scanSQLiteTimes(&user.CreatedAt, createdAt, &user.UpdatedAt, updatedAt); err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return user, nil
+}
+
+// RegisterUser inserts a new user into the database with password hashing
+func (s *SQLiteStore) RegisterUser(ctx context.Context, user *User) error {
+	// Ensure status is valid before creating user
+	if !IsValidStatus(user.Status) {
+		user.Status = StatusActive // Default to active if invalid
+	}
+	if !IsValidRole(user.Role) {
+		user.Role = RoleUser
+	}
+	hashedPassword, err := tracing.GenerateFromPassword(ctx, []byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user.PasswordHash = string(hashedPassword)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	query := `INSERT INTO users (first_name, last_name, phone_number, email, status, role, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, version`
+	err = s.q.QueryRowContext(ctx, query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.Role, user.PasswordHash, sqliteTime(now), sqliteTime(now)).Scan(&user.ID, &user.Version)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", sqliteStoreError(err))
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (s *SQLiteStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL`
+	user := &User{}
+	var createdAt, updatedAt string
+
+	err := s.q.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", sqliteStoreError(err))
+	}
+	if err := scanSQLiteTimes(&user.CreatedAt, createdAt, &user.UpdatedAt, updatedAt); err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers retrieves one page of users matching params
+func (s *SQLiteStore) ListUsers(ctx context.Context, params UserListParams) (*UserPage, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	placeholder := func(int) string { return "?" }
+	clauses, args, err := userListSQL(params, placeholder, "LIKE", func(t time.Time) any { return sqliteTime(t) })
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at FROM users` + clauses
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		user := &User{}
+		var createdAt, updatedAt string
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if err := scanSQLiteTimes(&user.CreatedAt, createdAt, &user.UpdatedAt, updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return newUserPage(users, params), nil
+}
+
+// SearchUsers ranks users by case-insensitive substring matches of the query
+// in their name, email and phone number, scored like MemoryStore.SearchUsers.
+// SQLite has no trigram support, so there is no fuzzy matching.
+func (s *SQLiteStore) SearchUsers(ctx context.Context, params UserSearchParams) (*UserSearchPage, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	// ?1 is the query, ?2 the prefix pattern and ?3 the substring pattern
+	score := func(column string) string {
+		return fmt.Sprintf(`CASE WHEN lower(%[1]s) = lower(?1) THEN %[2]v WHEN %[1]s LIKE ?2 ESCAPE '\' THEN %[3]v WHEN %[1]s LIKE ?3 ESCAPE '\' THEN %[4]v ELSE 0 END`,
+			column, exactMatchRank, prefixMatchRank, substrMatchRank)
+	}
+	var scores []string
+	for _, column := range []string{"first_name", "last_name", "first_name || ' ' || last_name", "email", "phone_number"} {
+		scores = append(scores, score(column))
+	}
+
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at, rank FROM (
+		SELECT *, max(` + strings.Join(scores, ", ") + `) AS rank FROM users WHERE deleted_at IS NULL
+	) WHERE rank > 0 ORDER BY rank DESC, id LIMIT ?4 OFFSET ?5`
+
+	pattern := escapeLike(params.Query)
+	rows, err := s.q.QueryContext(ctx, query, params.Query, pattern+"%", "%"+pattern+"%", params.Limit+1, params.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	var ranks []float64
+
+	for rows.Next() {
+		user := &User{}
+		var createdAt, updatedAt string
+		var rank float64
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &createdAt, &updatedAt, &rank)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if err := scanSQLiteTimes(&user.CreatedAt, createdAt, &user.UpdatedAt, updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		users = append(users, user)
+		ranks = append(ranks, rank)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return newUserSearchPage(users, ranks, params), nil
+}
+
+// UpdateUser updates an existing users' information, bumps its updated_at and
+// increments its version. When user.Version is set, the update only applies
+// to that version of the row and fails with ErrVersionConflict otherwise.
+// Updating a missing user fails with ErrNotFound.
+func (s *SQLiteStore) UpdateUser(ctx context.Context, user *User) error {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	query := `UPDATE users SET first_name = ?, last_name = ?, phone_number = ?, email = ?, status = ?, role = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL AND (?9 = 0 OR version = ?9) RETURNING version`
+	err := s.q.QueryRowContext(ctx, query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.Role, sqliteTime(now), user.ID, user.Version).Scan(&user.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to update user: %w", s.missedUpdateError(ctx, user))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", sqliteStoreError(err))
+	}
+	user.UpdatedAt = now
+
+	return nil
+}
+
+// missedUpdateError explains why a conditional update of user matched no
+// row: ErrVersionConflict if the user exists at another version, ErrNotFound
+// if it does not exist or is deleted
+func (s *SQLiteStore) missedUpdateError(ctx context.Context, user *User) error {
+	if user.Version == 0 {
+		return ErrNotFound
+	}
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL)`
+	if err := s.q.QueryRowContext(ctx, query, user.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// DeleteUser soft deletes a user by ID: the user is hidden from every read
+// until restored or purged, and their refresh tokens are revoked. It returns
+// ErrNotFound if there is no user with that ID that is not already deleted.
+func (s *SQLiteStore) DeleteUser(ctx context.Context, id int64) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*SQLiteStore).q
+		now := sqliteTime(time.Now())
+
+		query := `UPDATE users SET deleted_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`
+		result, err := q.ExecContext(ctx, query, now, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("failed to delete user: %w", ErrNotFound)
+		}
+
+		if _, err := q.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// RestoreUser undoes the soft delete of a user. It returns ErrUserNotDeleted
+// if there is no deleted user with that ID.
+func (s *SQLiteStore) RestoreUser(ctx context.Context, id int64) error {
+	query := `UPDATE users SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL`
+	result, err := s.q.ExecContext(ctx, query, sqliteTime(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to restore user: %w", ErrUserNotDeleted)
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently deletes the users soft deleted before the
+// given time and returns how many were removed.
+func (s *SQLiteStore) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM users WHERE deleted_at < ?`
+	result, err := s.q.ExecContext(ctx, query, sqliteTime(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ChangeUserStatus sets the status of a user, records the change and revokes
+// the user's refresh tokens unless the new status is active.
+func (s *SQLiteStore) ChangeUserStatus(ctx context.Context, change *UserStatusChange) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*SQLiteStore).q
+		now := time.Now().UTC().Truncate(time.Microsecond)
+
+		err := q.QueryRowContext(ctx, `SELECT status FROM users WHERE id = ? AND deleted_at IS NULL`, change.UserID).Scan(&change.OldStatus)
+		if err != nil {
+			return fmt.Errorf("failed to change user status: %w", sqliteStoreError(err))
+		}
+
+		query := `UPDATE users SET status = ?, updated_at = ?, version = version + 1 WHERE id = ?`
+		if _, err := q.ExecContext(ctx, query, change.NewStatus, sqliteTime(now), change.UserID); err != nil {
+			return fmt.Errorf("failed to change user status: %w", sqliteStoreError(err))
+		}
+
+		query = `INSERT INTO user_status_changes (user_id, old_status, new_status, reason, changed_by, created_at) VALUES (?, ?, ?, ?, NULLIF(?, 0), ?) RETURNING id`
+		err = q.QueryRowContext(ctx, query, change.UserID, change.OldStatus, change.NewStatus, change.Reason, change.ChangedBy, sqliteTime(now)).Scan(&change.ID)
+		if err != nil {
+			return fmt.Errorf("failed to change user status: %w", sqliteStoreError(err))
+		}
+		change.CreatedAt = now
+
+		if change.NewStatus != StatusActive {
+			if _, err := q.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = ?`, change.UserID); err != nil {
+				return fmt.Errorf("failed to change user status: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ListUserStatusChanges returns the status changes of a user, newest first
+func (s *SQLiteStore) ListUserStatusChanges(ctx context.Context, userID int64) ([]*UserStatusChange, error) {
+	query := `SELECT id, user_id, old_status, new_status, reason, COALESCE(changed_by, 0), created_at FROM user_status_changes WHERE user_id = ? ORDER BY id DESC`
+	rows, err := s.q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user status changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*UserStatusChange{}
+	for rows.Next() {
+		change := &UserStatusChange{}
+		var createdAt string
+		if err := rows.Scan(&change.ID, &change.UserID, &change.OldStatus, &change.NewStatus, &change.Reason, &change.ChangedBy, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user status change: %w", err)
+		}
+		if change.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %w", createdAt, err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return changes, nil
+}
+
+// AppendAuditEvent seals event against the newest stored event and inserts
+// it. SQLite serializes writers, so the chain head cannot change in between.
+func (s *SQLiteStore) AppendAuditEvent(ctx context.Context, event *audit.Event) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*SQLiteStore).q
+
+		var prevHash string
+		err := q.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to read audit chain head: %w", err)
+		}
+		event.Seal(prevHash, time.Now())
+
+		query := `INSERT INTO audit_events (occurred_at, actor_id, target_id, action, ip, user_agent, request_id, diff, prev_hash, hash)
+			VALUES (?, NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+		err = q.QueryRowContext(ctx, query, sqliteTime(event.OccurredAt), event.ActorID, event.TargetID, event.Action, event.IP, event.UserAgent, event.RequestID, auditDiffArg(event.Diff), event.PrevHash, event.Hash).Scan(&event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to append audit event: %w", sqliteStoreError(err))
+		}
+
+		return nil
+	})
+}
+
+// ListAuditEvents returns one page of audit events matching filter, newest
+// first
+func (s *SQLiteStore) ListAuditEvents(ctx context.Context, filter audit.Filter) (*audit.Page, error) {
+	filter = filter.WithDefaults()
+	placeholder := func(int) string { return "?" }
+	clauses, args := auditEventListSQL(filter, placeholder, func(t time.Time) any { return sqliteTime(t) })
+
+	rows, err := s.q.QueryContext(ctx, `SELECT `+auditEventColumns+` FROM audit_events`+clauses, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*audit.Event
+	for rows.Next() {
+		event := &audit.Event{}
+		var occurredAt string
+		var diff sql.NullString
+		err := rows.Scan(&event.ID, &occurredAt, &event.ActorID, &event.TargetID, &event.Action, &event.IP, &event.UserAgent, &event.RequestID, &diff, &event.PrevHash, &event.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if event.OccurredAt, err = time.Parse(sqliteTimeLayout, occurredAt); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %w", occurredAt, err)
+		}
+		if diff.Valid {
+			event.Diff = json.RawMessage(diff.String)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return audit.NewPage(events, filter), nil
+}
+
+// CreateRefreshToken inserts a new refresh token into the database
+func (s *SQLiteStore) CreateRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, token, expires_at, created_at) VALUES (?, ?, ?, ?) RETURNING id`
+	err := s.q.QueryRowContext(ctx, query, rt.UserID, rt.Token, sqliteTime(rt.ExpiresAt), sqliteTime(rt.CreatedAt)).Scan(&rt.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", sqliteStoreError(err))
+	}
+
+	return nil
+}
+
+// GetRefreshToken returns the newest unexpired refresh token of a user
+func (s *SQLiteStore) GetRefreshToken(ctx context.Context, userID int64) (*RefreshToken, error) {
+	query := `SELECT id, user_id, token, expires_at, created_at FROM refresh_tokens WHERE user_id = ? AND expires_at > ? ORDER BY id DESC LIMIT 1`
+	rt := &RefreshToken{}
+	var expiresAt, createdAt string
+
+	err := s.q.QueryRowContext(ctx, query, userID, sqliteTime(time.Now())).Scan(&rt.ID, &rt.UserID, &rt.Token, &expiresAt, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", sqliteStoreError(err))
+	}
+	if err := scanSQLiteTimes(&rt.ExpiresAt, expiresAt, &rt.CreatedAt, createdAt); err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return rt, nil
+}
+
+// DeleteRefreshToken delete refresh token by user_id
+func (s *SQLiteStore) DeleteRefreshToken(ctx context.Context, userID int64) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = ?`
+	_, err := s.q.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// scanSQLiteTimes parses pairs of (destination, stored text) timestamps.
+func scanSQLiteTimes(first *time.Time, firstText string, second *time.Time, secondText string) error {
+	var err error
+	if *first, err = time.Parse(sqliteTimeLayout, firstText); err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", firstText, err)
+	}
+	if *second, err = time.Parse(sqliteTimeLayout, secondText); err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", secondText, err)
+	}
+
+	return nil
+}
+
+// sqliteStoreError translates sql.ErrNoRows and constraint violations into the
+// Store errors. Other errors are returned unchanged.
+func sqliteStoreError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		// SQLite names the column instead of the constraint
+		switch msg := sqliteErr.Error(); {
+		case strings.Contains(msg, "users.email"):
+			return fmt.Errorf("%w: %w", ErrDuplicateEmail, err)
+		case strings.Contains(msg, "users.phone_number"):
+			return fmt.Errorf("%w: %w", ErrDuplicatePhone, err)
+		}
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	return err
+}
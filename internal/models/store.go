@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
+)
+
+// Store is the full set of storage operations used by the handlers. The
+// Postgres implementation is *User; SQLiteStore and MemoryStore cover
+// single-node deployments and development.
+type Store interface {
+	RegisterUser(ctx context.Context, user *User) error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	ListUsers(ctx context.Context, params UserListParams) (*UserPage, error)
+	SearchUsers(ctx context.Context, params UserSearchParams) (*UserSearchPage, error)
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) error
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+
+	// ChangeUserStatus sets the status of change.UserID to change.NewStatus
+	// and records the change. Unless the new status is active, the user's
+	// refresh tokens are revoked in the same transaction.
+	ChangeUserStatus(ctx context.Context, change *UserStatusChange) error
+	ListUserStatusChanges(ctx context.Context, userID int64) ([]*UserStatusChange, error)
+
+	CreateRefreshToken(ctx context.Context, rt *RefreshToken) error
+	GetRefreshToken(ctx context.Context, userID int64) (*RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, userID int64) error
+
+	// Handlers append audit events inside the transaction of the change they
+	// record, so a change and its event are committed together.
+	audit.Store
+
+	// WithTx runs fn in a single transaction. Every call made through the
+	// Store passed to fn is part of it; the transaction commits if fn returns
+	// nil and rolls back otherwise.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+var (
+	_ Store = (*User)(nil)
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// Errors returned by every Store in place of driver errors, so callers can
+// tell failures apart without knowing the backend. The driver error stays in
+// the chain for the logs.
+var (
+	// ErrNotFound is returned when the requested user or refresh token does
+	// not exist, or a refresh token refers to a missing user.
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicateEmail and ErrDuplicatePhone are returned when a user would
+	// share its email or phone number with another one, including soft
+	// deleted users that have not been purged yet.
+	ErrDuplicateEmail = errors.New("email is already registered")
+	ErrDuplicatePhone = errors.New("phone number is already registered")
+
+	// ErrDuplicate is returned for any other unique constraint violation.
+	ErrDuplicate = errors.New("duplicate value")
+
+	// ErrInvalidValue is returned when a value violates a check constraint or
+	// a column length.
+	ErrInvalidValue = errors.New("value violates a constraint")
+)
+
+// ErrVersionConflict is returned by UpdateUser when the stored user no longer
+// has the version the update was based on.
+var ErrVersionConflict = errors.New("user was modified concurrently")
+
+// ErrUserNotDeleted is returned by RestoreUser when there is no soft deleted
+// user with the given ID.
+var ErrUserNotDeleted = errors.New("user does not exist or is not deleted")
+
+// Valid values for User.Status, mirroring the CHECK constraint on users.status.
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+	StatusBanned   = "banned"
+)
+
+// IsValidStatus reports whether status is accepted by the users table.
+func IsValidStatus(status string) bool {
+	return status == StatusActive || status == StatusInactive || status == StatusBanned
+}
+
+// Valid values for User.Role. Admins can list, search and manage all users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsValidRole reports whether role is accepted by the users table.
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+)
+
+func TestMain(m *testing.M) {
+	cleanup := config.SetupTestDB(m)
+
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
+
+// storeBackend opens an empty store for a single conformance test.
+type storeBackend struct {
+	name string
+	open func(t *testing.T) Store
+}
+
+// testBackends lists every backend the conformance suite runs against.
+// Postgres is only included when config.TestStorageBackend selects it.
+func testBackends() []storeBackend {
+	backends := []storeBackend{
+		{name: "memory", open: func(t *testing.T) Store {
+			return NewMemoryStore()
+		}},
+		{name: "sqlite", open: func(t *testing.T) Store {
+			store, err := NewSQLiteStore("sqlite://"+filepath.Join(t.TempDir(), "test.db"), nil)
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		}},
+	}
+
+	if config.TestStorageBackend() == "postgres" {
+		backends = append(backends, storeBackend{name: "postgres", open: func(t *testing.T) Store {
+			_, err := config.DbConn.GetPool().Exec(context.Background(), "TRUNCATE TABLE refresh_tokens, users, audit_events RESTART IDENTITY CASCADE")
+			if err != nil {
+				t.Fatalf("failed to truncate tables: %v", err)
+			}
+			return NewPostgresStore(nil)
+		}})
+	}
+
+	return backends
+}
+
+// TestStoreConformance runs the shared behavior checks in user_test.go
+// against each backend, so they all honour the constraints of the SQL schema.
+func TestStoreConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store Store)
+	}{
+		{"CreateAndGetUser", testCreateAndGetUser},
+		{"UpdateUser", testUpdateUser},
+		{"DeleteUser", testDeleteUser},
+		{"CreateAndDeleteRefreshToken", testCreateAndDeleteRefreshToken},
+		{"ListUsers", testListUsers},
+		{"ListUsersPagination", testListUsersPagination},
+		{"ListUsersFilters", testListUsersFilters},
+		{"SearchUsers", testSearchUsers},
+		{"SearchUsersPagination", testSearchUsersPagination},
+		{"Roles", testRoles},
+		{"OptimisticLocking", testOptimisticLocking},
+		{"SoftDelete", testSoftDelete},
+		{"PurgeDeletedUsers", testPurgeDeletedUsers},
+		{"UserStatusChanges", testUserStatusChanges},
+		{"AuditEvents", testAuditEvents},
+		{"ConcurrentAuditAppends", testConcurrentAuditAppends},
+		{"AuditLockScope", testAuditLockScope},
+		{"NotFound", testNotFound},
+		{"UniqueConstraints", testUniqueConstraints},
+		{"StatusCheck", testStatusCheck},
+		{"ColumnLengths", testColumnLengths},
+		{"DeleteUserCascades", testDeleteUserCascades},
+		{"HidesPasswordHash", testHidesPasswordHash},
+		{"ExpiredRefreshToken", testExpiredRefreshToken},
+		{"WithTxCommit", testWithTxCommit},
+		{"WithTxRollback", testWithTxRollback},
+		{"WithTxNested", testWithTxNested},
+	}
+
+	for _, backend := range testBackends() {
+		t.Run(backend.name, func(t *testing.T) {
+			for _, tc := range tests {
+				t.Run(tc.name, func(t *testing.T) {
+					tc.fn(t, backend.open(t))
+				})
+			}
+		})
+	}
+}
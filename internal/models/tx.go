@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+)
+
+// maxTxAttempts bounds how often WithTx retries a transaction that failed
+// with a serialization failure or deadlock.
+const maxTxAttempts = 5
+
+// auditChainLock serializes the transactions that append to the audit chain,
+// so each reads the head the previous one committed and writers queue instead
+// of aborting on the unique prev_hash. A serializable transaction freezes its
+// snapshot at its first query, so the lock must be taken before it; unlike
+// SELECT pg_advisory_xact_lock, LOCK TABLE does not take a snapshot. The mode
+// conflicts with itself and with inserts but not with reads, so transactions
+// that do not append are never blocked by it.
+const auditChainLock = `LOCK TABLE audit_events IN SHARE ROW EXCLUSIVE MODE`
+
+type auditAppendKey struct{}
+
+// WithAuditAppend returns a copy of ctx for a WithTx call whose transaction
+// appends an audit event after other statements, as the handlers do. The
+// Postgres store then takes auditChainLock before the first statement;
+// other backends ignore it.
+func WithAuditAppend(ctx context.Context) context.Context {
+	return context.WithValue(ctx, auditAppendKey{}, true)
+}
+
+// auditAppendRequested reports whether ctx was marked by WithAuditAppend
+func auditAppendRequested(ctx context.Context) bool {
+	appends, _ := ctx.Value(auditAppendKey{}).(bool)
+	return appends
+}
+
+// errLateAuditAppend is returned by AppendAuditEvent in a transaction that
+// already took its snapshot without auditChainLock. WithTx retries it with
+// the lock taken first.
+var errLateAuditAppend = errors.New("audit event appended after the transaction's first statement")
+
+// WithTx runs fn in a serializable Postgres transaction. The Store passed to
+// fn is bound to the transaction; it is committed when fn returns nil and
+// rolled back otherwise. A transaction marked by WithAuditAppend takes
+// auditChainLock before its first statement, leaving work such as password
+// hashing done before then outside the lock; one whose first statement is
+// the append takes it then. An unmarked transaction that appends later is
+// retried as if it had been marked. Serialization failures and deadlocks
+// retry the whole transaction, so fn must not have side effects outside the
+// Store. Calling WithTx on a Store that is already in a transaction reuses
+// it.
+func (u *User) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if u != nil && u.tx != nil {
+		return fn(u)
+	}
+
+	lockFirst := auditAppendRequested(ctx)
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = pgx.BeginTxFunc(ctx, config.DbConn.GetPool(), pgx.TxOptions{IsoLevel: pgx.Serializable}, func(tx pgx.Tx) error {
+			return fn(&User{tx: &chainTx{Tx: tx, lockFirst: lockFirst}, logger: u.log()})
+		})
+		if errors.Is(err, errLateAuditAppend) && !lockFirst {
+			u.log().WarnContext(ctx, "retrying transaction with the audit chain locked; mark it with WithAuditAppend")
+			lockFirst = true
+			attempt--
+			continue
+		}
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+		u.log().WarnContext(ctx, "retrying transaction", "attempt", attempt, "error", err)
+
+		// Back off a little longer after each conflict
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+
+	return fmt.Errorf("transaction failed after %d attempts: %w", maxTxAttempts, err)
+}
+
+// isRetryableTxError reports whether err is a serialization_failure or
+// deadlock_detected error, after which the transaction can be retried.
+func isRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
+
+// chainTx tracks whether a transaction holds auditChainLock and whether it
+// has run a statement, and so taken its snapshot
+type chainTx struct {
+	pgx.Tx
+	lockFirst bool // take the lock before the first statement
+	locked    bool
+	used      bool
+}
+
+func (t *chainTx) lock(ctx context.Context) error {
+	if _, err := t.Tx.Exec(ctx, auditChainLock); err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+	t.locked = true
+	return nil
+}
+
+// lockForAppend takes auditChainLock before AppendAuditEvent reads the chain
+// head. It returns errLateAuditAppend if the snapshot was already taken
+// without it.
+func (t *chainTx) lockForAppend(ctx context.Context) error {
+	switch {
+	case t.locked:
+		return nil
+	case t.used:
+		return errLateAuditAppend
+	default:
+		return t.lock(ctx)
+	}
+}
+
+// beforeStatement takes the lock first if the transaction was marked
+func (t *chainTx) beforeStatement(ctx context.Context) error {
+	if t.lockFirst && !t.locked {
+		if err := t.lock(ctx); err != nil {
+			return err
+		}
+	}
+	t.used = true
+	return nil
+}
+
+func (t *chainTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	if err := t.beforeStatement(ctx); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return t.Tx.Exec(ctx, sql, arguments...)
+}
+
+func (t *chainTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := t.beforeStatement(ctx); err != nil {
+		return nil, err
+	}
+	return t.Tx.Query(ctx, sql, args...)
+}
+
+func (t *chainTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := t.beforeStatement(ctx); err != nil {
+		return errRow{err}
+	}
+	return t.Tx.QueryRow(ctx, sql, args...)
+}
+
+// errRow is a pgx.Row whose Scan returns err
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...any) error { return r.err }
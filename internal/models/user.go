@@ -2,10 +2,18 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,10 +25,44 @@ type User struct {
 	PhoneNumber  string    `json:"phone_number"`
 	Email        string    `json:"email"`
 	Status       string    `json:"status"`
-	Password     string    `json:"password,omitempty"` // plain password, not stored in DB
-	PasswordHash string    `json:"passwrod_hash"`
+	Role         string    `json:"role"`
+	Version      int64     `json:"version"` // incremented by every update
+	Password     string    `json:"-"`       // plain password, not stored in DB
+	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	tx     pgx.Tx       // set on the Store passed to WithTx callbacks
+	logger *slog.Logger // set on the Store returned by NewPostgresStore
+}
+
+// NewPostgresStore returns a Store backed by the pool in config.DbConn,
+// logging to logger, or to the default logger when it is nil
+func NewPostgresStore(logger *slog.Logger) *User {
+	return &User{logger: logging.OrDefault(logger)}
+}
+
+// log returns the logger the store was created with
+func (u *User) log() *slog.Logger {
+	if u == nil {
+		return slog.Default()
+	}
+	return logging.OrDefault(u.logger)
+}
+
+// querier is the subset of pgxpool.Pool and pgx.Tx used by the queries below
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// db returns the transaction the user was bound to by WithTx, or the pool
+func (u *User) db() querier {
+	if u != nil && u.tx != nil {
+		return u.tx
+	}
+	return config.DbConn.GetPool()
 }
 
 // RefreshToken represents a refresh token in the system
@@ -32,60 +74,74 @@ type RefreshToken struct {
 	CreatedAt time.Time `json:"updated_at"`
 }
 
-// GetUserByEmail retr4ieves a user by email
-func (u *User) GetUserByEmail(email string) (*User, error) {
-	fmt.Println("Getting user by email:", email)
-	query := `SELECT id, first_name, last_name, phone_number, email, password_hash, status, created_at, updated_at FROM  users WHERE email = $1`
+// GetUserByEmail retrieves a user by email. It always reads from the
+// primary, as it authenticates logins, which must see fresh registrations,
+// password changes and status changes.
+func (u *User) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT id, first_name, last_name, phone_number, email, password_hash, status, role, version, created_at, updated_at FROM  users WHERE email = $1 AND deleted_at IS NULL`
 	user := &User{}
 
-	err := config.DbConn.GetPool().QueryRow(context.Background(), query, email).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.PasswordHash, &user.Status, &user.CreatedAt, &user.UpdatedAt)
+	err := u.db().QueryRow(ctx, query, email).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.PasswordHash, &user.Status, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", pgStoreError(err))
 	}
 
 	return user, nil
 }
 
 // CreateUser inserts a new user into the database with password hashing
-func (u *User) RegisterUser(user *User) error {
+func (u *User) RegisterUser(ctx context.Context, user *User) error {
 	// Ensure status is valid before creating user
-	if user.Status != "active" && user.Status != "inactive" && user.Status != "banned" {
-		user.Status = "active" // Default to active if invalid
+	if !IsValidStatus(user.Status) {
+		user.Status = StatusActive // Default to active if invalid
+	}
+	if !IsValidRole(user.Role) {
+		user.Role = RoleUser
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := tracing.GenerateFromPassword(ctx, []byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	user.PasswordHash = string(hashedPassword)
 
-	query := `INSERT INTO users (first_name, last_name, phone_number, email, status, password_hash) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`
-	err = config.DbConn.GetPool().QueryRow(context.Background(), query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.PasswordHash).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	query := `INSERT INTO users (first_name, last_name, phone_number, email, status, role, password_hash) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version, created_at, updated_at`
+	err = u.db().QueryRow(ctx, query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.Role, user.PasswordHash).Scan(&user.ID, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return fmt.Errorf("failed to create user: %w", pgStoreError(err))
 	}
 
 	return nil
 }
 
 // GetUserByID retrives a user by ID
-func (u *User) GetUserByID(id int64) (*User, error) {
-	query := `SELECT id, first_name, last_name, phone_number, email, status, created_at, updated_at FROM  users WHERE id = $1`
+func (u *User) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at FROM  users WHERE id = $1 AND deleted_at IS NULL`
 	user := &User{}
 
-	err := config.DbConn.GetPool().QueryRow(context.Background(), query, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.CreatedAt, &user.UpdatedAt)
+	err := u.readDB(ctx).QueryRow(ctx, query, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by id: %w", err)
+		return nil, fmt.Errorf("failed to get user by id: %w", pgStoreError(err))
 	}
 
 	return user, nil
 }
 
-// GetAllUsers retrives all users from the database
-func (u *User) GetAllUsers() ([]*User, error) {
-	query := `SELECT id, first_name, last_name, phone_number, email, status, created_at, updated_at FROM  users`
+// ListUsers retrieves one page of users matching params
+func (u *User) ListUsers(ctx context.Context, params UserListParams) (*UserPage, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := config.DbConn.GetPool().Query(context.Background(), query)
+	placeholder := func(n int) string { return "$" + strconv.Itoa(n) }
+	clauses, args, err := userListSQL(params, placeholder, "ILIKE", func(t time.Time) any { return t })
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at FROM users` + clauses
+
+	rows, err := u.readDB(ctx).Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -95,7 +151,7 @@ func (u *User) GetAllUsers() ([]*User, error) {
 
 	for rows.Next() {
 		user := &User{}
-		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.CreatedAt, &user.UpdatedAt)
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
@@ -107,24 +163,107 @@ func (u *User) GetAllUsers() ([]*User, error) {
 		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	return users, nil
+	return newUserPage(users, params), nil
 }
 
-// UpdateUser updates an existing users' information
-func (u *User) UpdateUser(user *User) error {
-	query := `UPDATE users SET first_name = $1, last_name = $2, phone_number = $3, email = $4, status= $5 WHERE id = $6`
-	_, err := config.DbConn.GetPool().Exec(context.Background(), query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.ID)
+// SearchUsers ranks users by trigram word similarity between the query and
+// their full name, email and phone number, so misspellings still match.
+// Plain substring matches are included even when their similarity is below
+// the pg_trgm threshold. Both conditions use the trigram indexes.
+func (u *User) SearchUsers(ctx context.Context, params UserSearchParams) (*UserSearchPage, error) {
+	params, err := params.withDefaults()
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, err
+	}
+
+	query := `SELECT id, first_name, last_name, phone_number, email, status, role, version, created_at, updated_at,
+		GREATEST(word_similarity($1, first_name || ' ' || last_name), word_similarity($1, email), word_similarity($1, phone_number)) AS rank
+		FROM users
+		WHERE deleted_at IS NULL AND ($1 <% (first_name || ' ' || last_name) OR $1 <% email OR $1 <% phone_number
+			OR (first_name || ' ' || last_name) ILIKE $2 ESCAPE '\' OR email ILIKE $2 ESCAPE '\' OR phone_number ILIKE $2 ESCAPE '\')
+		ORDER BY rank DESC, id
+		LIMIT $3 OFFSET $4`
+
+	rows, err := u.readDB(ctx).Query(ctx, query, params.Query, "%"+escapeLike(params.Query)+"%", params.Limit+1, params.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	var ranks []float64
+
+	for rows.Next() {
+		user := &User{}
+		var rank float32
+		err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.Email, &user.Status, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt, &rank)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		users = append(users, user)
+		ranks = append(ranks, float64(rank))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return newUserSearchPage(users, ranks, params), nil
+}
+
+// UpdateUser updates an existing users' information, bumps its updated_at and
+// increments its version. When user.Version is set, the update only applies
+// to that version of the row and fails with ErrVersionConflict otherwise.
+// Updating a missing user fails with ErrNotFound.
+func (u *User) UpdateUser(ctx context.Context, user *User) error {
+	query := `UPDATE users SET first_name = $1, last_name = $2, phone_number = $3, email = $4, status = $5, role = $6, updated_at = NOW(), version = version + 1
+		WHERE id = $7 AND deleted_at IS NULL AND ($8::integer = 0 OR version = $8) RETURNING updated_at, version`
+	err := u.db().QueryRow(ctx, query, user.FirstName, user.LastName, user.PhoneNumber, user.Email, user.Status, user.Role, user.ID, user.Version).Scan(&user.UpdatedAt, &user.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to update user: %w", u.missedUpdateError(ctx, user))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", pgStoreError(err))
 	}
 
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func (u *User) DeleteUser(id int64) error {
-	query := `DELETE FROM users WHERE ID = $1`
-	_, err := config.DbConn.GetPool().Exec(context.Background(), query, id)
+// missedUpdateError explains why a conditional update of user matched no
+// row: ErrVersionConflict if the user exists at another version, ErrNotFound
+// if it does not exist or is deleted
+func (u *User) missedUpdateError(ctx context.Context, user *User) error {
+	if user.Version == 0 {
+		return ErrNotFound
+	}
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`
+	if err := u.db().QueryRow(ctx, query, user.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// DeleteUser soft deletes a user by ID: the user is hidden from every read
+// until restored or purged, and their refresh tokens are revoked. It returns
+// ErrNotFound if there is no user with that ID that is not already deleted.
+func (u *User) DeleteUser(ctx context.Context, id int64) error {
+	query := `WITH deleted AS (
+			UPDATE users SET deleted_at = NOW(), updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL RETURNING id
+		), revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id IN (SELECT id FROM deleted)
+		)
+		SELECT id FROM deleted`
+	var deletedID int64
+	err := u.db().QueryRow(ctx, query, id).Scan(&deletedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to delete user: %w", ErrNotFound)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -132,36 +271,208 @@ func (u *User) DeleteUser(id int64) error {
 	return nil
 }
 
+// RestoreUser undoes the soft delete of a user. It returns ErrUserNotDeleted
+// if there is no deleted user with that ID.
+func (u *User) RestoreUser(ctx context.Context, id int64) error {
+	query := `UPDATE users SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
+	tag, err := u.db().Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to restore user: %w", ErrUserNotDeleted)
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently deletes the users soft deleted before the
+// given time and returns how many were removed.
+func (u *User) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM users WHERE deleted_at < $1`
+	tag, err := u.db().Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ChangeUserStatus sets the status of a user, records the change and revokes
+// the user's refresh tokens unless the new status is active, in a single
+// statement.
+func (u *User) ChangeUserStatus(ctx context.Context, change *UserStatusChange) error {
+	query := `WITH target AS (
+			SELECT id, status FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		), updated AS (
+			UPDATE users SET status = $2, updated_at = NOW(), version = users.version + 1 FROM target WHERE users.id = target.id RETURNING users.id
+		), revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id IN (SELECT id FROM updated) AND $2 <> 'active'
+		)
+		INSERT INTO user_status_changes (user_id, old_status, new_status, reason, changed_by)
+		SELECT target.id, target.status, $2, $3, NULLIF($4, 0) FROM target JOIN updated ON updated.id = target.id
+		RETURNING id, old_status, created_at`
+	err := u.db().QueryRow(ctx, query, change.UserID, change.NewStatus, change.Reason, change.ChangedBy).Scan(&change.ID, &change.OldStatus, &change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to change user status: %w", pgStoreError(err))
+	}
+
+	return nil
+}
+
+// ListUserStatusChanges returns the status changes of a user, newest first
+func (u *User) ListUserStatusChanges(ctx context.Context, userID int64) ([]*UserStatusChange, error) {
+	query := `SELECT id, user_id, old_status, new_status, reason, COALESCE(changed_by, 0), created_at FROM user_status_changes WHERE user_id = $1 ORDER BY id DESC`
+	rows, err := u.readDB(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user status changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*UserStatusChange{}
+	for rows.Next() {
+		change := &UserStatusChange{}
+		if err := rows.Scan(&change.ID, &change.UserID, &change.OldStatus, &change.NewStatus, &change.Reason, &change.ChangedBy, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user status change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return changes, nil
+}
+
+// AppendAuditEvent seals event against the newest stored event and inserts
+// it. The transaction holds auditChainLock from before its snapshot, so
+// concurrent appends queue and each reads the head the previous one
+// committed; the unique prev_hash still guards against a fork.
+func (u *User) AppendAuditEvent(ctx context.Context, event *audit.Event) error {
+	return u.WithTx(ctx, func(tx Store) error {
+		if chain, ok := tx.(*User).tx.(*chainTx); ok {
+			if err := chain.lockForAppend(ctx); err != nil {
+				return err
+			}
+		}
+		db := tx.(*User).db()
+
+		var prevHash string
+		err := db.QueryRow(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to read audit chain head: %w", err)
+		}
+		event.Seal(prevHash, time.Now())
+
+		query := `INSERT INTO audit_events (occurred_at, actor_id, target_id, action, ip, user_agent, request_id, diff, prev_hash, hash)
+			VALUES ($1, NULLIF($2::BIGINT, 0), NULLIF($3::BIGINT, 0), $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		err = db.QueryRow(ctx, query, event.OccurredAt, event.ActorID, event.TargetID, event.Action, event.IP, event.UserAgent, event.RequestID, auditDiffArg(event.Diff), event.PrevHash, event.Hash).Scan(&event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to append audit event: %w", pgStoreError(err))
+		}
+
+		return nil
+	})
+}
+
+// ListAuditEvents returns one page of audit events matching filter, newest
+// first
+func (u *User) ListAuditEvents(ctx context.Context, filter audit.Filter) (*audit.Page, error) {
+	filter = filter.WithDefaults()
+	placeholder := func(n int) string { return "$" + strconv.Itoa(n) }
+	clauses, args := auditEventListSQL(filter, placeholder, func(t time.Time) any { return t })
+
+	rows, err := u.readDB(ctx).Query(ctx, `SELECT `+auditEventColumns+` FROM audit_events`+clauses, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*audit.Event
+	for rows.Next() {
+		event := &audit.Event{}
+		var diff []byte
+		err := rows.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.TargetID, &event.Action, &event.IP, &event.UserAgent, &event.RequestID, &diff, &event.PrevHash, &event.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		event.Diff = diff
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return audit.NewPage(events, filter), nil
+}
+
 // CreateRefreshToken inserts a new refresh token into the database
-func (u *User) CreateRefreshToken(rt *RefreshToken) error {
+func (u *User) CreateRefreshToken(ctx context.Context, rt *RefreshToken) error {
 	query := `INSERT INTO refresh_tokens (user_id, token, expires_at, created_at) VALUES ($1, $2, $3, $4) RETURNING id`
-	err := config.DbConn.GetPool().QueryRow(context.Background(), query, rt.UserID, rt.Token, rt.ExpiresAt, rt.CreatedAt).Scan(&rt.ID)
+	err := u.db().QueryRow(ctx, query, rt.UserID, rt.Token, rt.ExpiresAt, rt.CreatedAt).Scan(&rt.ID)
 	if err != nil {
-		return fmt.Errorf("failed to create refresh token: %w", err)
+		return fmt.Errorf("failed to create refresh token: %w", pgStoreError(err))
 	}
 
 	return nil
 }
 
 // GetRefreshToken inserts a new refresh token into the database
-func (u *User) GetRefreshToken(userID int64) (*RefreshToken, error) {
+func (u *User) GetRefreshToken(ctx context.Context, userID int64) (*RefreshToken, error) {
 	query := `SELECT * FROM refresh_tokens WHERE user_id = $1 AND expires_at > NOW() ORDER BY id DESC LIMIT 1`
 	rt := &RefreshToken{}
-	err := config.DbConn.GetPool().QueryRow(context.Background(), query, userID).Scan(&rt.ID, &rt.UserID, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt)
+	err := u.db().QueryRow(ctx, query, userID).Scan(&rt.ID, &rt.UserID, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+		return nil, fmt.Errorf("failed to get refresh token: %w", pgStoreError(err))
 	}
 
 	return rt, nil
 }
 
 // DeleteRefreshToken delete refresh token by user_id
-func (u *User) DeleteRefreshToken(userId int64) error {
+func (u *User) DeleteRefreshToken(ctx context.Context, userId int64) error {
 	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
-	_, err := config.DbConn.GetPool().Exec(context.Background(), query, userId)
+	_, err := u.db().Exec(ctx, query, userId)
 	if err != nil {
 		return fmt.Errorf("failed to refresh token: %w", err)
 	}
 
 	return nil
 }
+
+// Postgres error codes translated by pgStoreError
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+	pgStringTooLong       = "22001"
+)
+
+// pgStoreError translates pgx.ErrNoRows and constraint violations into the
+// Store errors. Other errors are returned unchanged.
+func pgStoreError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		switch pgErr.ConstraintName {
+		case "users_email_key":
+			return fmt.Errorf("%w: %w", ErrDuplicateEmail, err)
+		case "users_phone_number_key":
+			return fmt.Errorf("%w: %w", ErrDuplicatePhone, err)
+		}
+		return fmt.Errorf("%w: %w", ErrDuplicate, err)
+	case pgForeignKeyViolation:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case pgCheckViolation, pgStringTooLong:
+		return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	return err
+}
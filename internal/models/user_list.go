@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Columns GET /users can be sorted by. Every sort is made unique by using the
+// id as a tie breaker, which keeps keyset pagination stable.
+const (
+	SortByID        = "id"
+	SortByCreatedAt = "created_at"
+	SortByEmail     = "email"
+)
+
+// Page sizes used when ListUsers is given no limit or too large a limit
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// UserListParams selects one page of users for ListUsers
+type UserListParams struct {
+	Status        string    // exact match, empty for any status
+	EmailContains string    // case-insensitive substring, empty for any email
+	CreatedAfter  time.Time // zero for no lower bound
+	SortField     string    // one of the SortBy constants
+	SortDesc      bool
+	Limit         int
+	Cursor        *UserCursor // position after which the page starts
+}
+
+// UserCursor is the keyset position of the last user on a page
+type UserCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// UserPage is a page of users and the cursor of the next page, if any
+type UserPage struct {
+	Users      []*User
+	NextCursor string
+	HasMore    bool
+}
+
+// ParseUserSort parses a sort parameter such as "created_at:desc". The
+// direction defaults to ascending.
+func ParseUserSort(sort string) (field string, desc bool, err error) {
+	field, direction, _ := strings.Cut(sort, ":")
+	switch field {
+	case SortByID, SortByCreatedAt, SortByEmail:
+	default:
+		return "", false, fmt.Errorf("unsupported sort field %q", field)
+	}
+
+	switch direction {
+	case "", "asc":
+		return field, false, nil
+	case "desc":
+		return field, true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported sort direction %q", direction)
+	}
+}
+
+// withDefaults fills in the default sort order (newest first) and clamps the
+// limit to MaxUserPageSize.
+func (p UserListParams) withDefaults() (UserListParams, error) {
+	switch p.SortField {
+	case "":
+		p.SortField, p.SortDesc = SortByCreatedAt, true
+	case SortByID, SortByCreatedAt, SortByEmail:
+	default:
+		return p, fmt.Errorf("unsupported sort field %q", p.SortField)
+	}
+
+	if p.Limit <= 0 {
+		p.Limit = DefaultUserPageSize
+	}
+	if p.Limit > MaxUserPageSize {
+		p.Limit = MaxUserPageSize
+	}
+
+	if p.Cursor != nil && p.Cursor.Sort != p.sortKey() {
+		return p, ErrInvalidCursor
+	}
+
+	return p, nil
+}
+
+// sortKey identifies a sort order inside a cursor
+func (p UserListParams) sortKey() string {
+	if p.SortDesc {
+		return p.SortField + ":desc"
+	}
+	return p.SortField + ":asc"
+}
+
+// DecodeUserCursor decodes an opaque cursor issued for the sort order of p
+func (p UserListParams) DecodeUserCursor(cursor string) (*UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &UserCursor{}
+	if err := json.Unmarshal(raw, c); err != nil || c.Sort != p.sortKey() {
+		return nil, ErrInvalidCursor
+	}
+	if p.SortField == SortByCreatedAt {
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return c, nil
+}
+
+// encode returns the opaque form of c
+func (c *UserCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorFor returns the cursor positioned at user
+func (p UserListParams) cursorFor(user *User) *UserCursor {
+	c := &UserCursor{Sort: p.sortKey(), ID: user.ID}
+	switch p.SortField {
+	case SortByCreatedAt:
+		c.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByEmail:
+		c.Value = user.Email
+	}
+	return c
+}
+
+// newUserPage builds a page from up to Limit+1 users fetched in sort order;
+// the extra row only signals that another page exists.
+func newUserPage(users []*User, p UserListParams) *UserPage {
+	page := &UserPage{Users: users}
+	if len(users) > p.Limit {
+		page.Users = users[:p.Limit]
+		page.HasMore = true
+		page.NextCursor = p.cursorFor(page.Users[len(page.Users)-1]).encode()
+	}
+	if page.Users == nil {
+		page.Users = []*User{}
+	}
+	return page
+}
+
+// userListSQL renders the WHERE, ORDER BY and LIMIT clauses of a ListUsers
+// query for params that went through withDefaults. Only whitelisted column
+// names are interpolated; every value is a bind parameter rendered by
+// placeholder. timeArg converts timestamps to the representation the
+// database stores and like is its case-insensitive LIKE operator.
+func userListSQL(p UserListParams, placeholder func(n int) string, like string, timeArg func(time.Time) any) (string, []any, error) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []any
+	bind := func(v any) string {
+		args = append(args, v)
+		return placeholder(len(args))
+	}
+
+	if p.Status != "" {
+		conds = append(conds, "status = "+bind(p.Status))
+	}
+	if p.EmailContains != "" {
+		conds = append(conds, fmt.Sprintf(`email %s %s ESCAPE '\'`, like, bind("%"+escapeLike(p.EmailContains)+"%")))
+	}
+	if !p.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at > "+bind(timeArg(p.CreatedAfter)))
+	}
+
+	op, direction := ">", "ASC"
+	if p.SortDesc {
+		op, direction = "<", "DESC"
+	}
+
+	if c := p.Cursor; c != nil {
+		switch p.SortField {
+		case SortByID:
+			conds = append(conds, fmt.Sprintf("id %s %s", op, bind(c.ID)))
+		case SortByCreatedAt:
+			after, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return "", nil, ErrInvalidCursor
+			}
+			conds = append(conds, fmt.Sprintf("(created_at, id) %s (%s, %s)", op, bind(timeArg(after)), bind(c.ID)))
+		case SortByEmail:
+			conds = append(conds, fmt.Sprintf("(email, id) %s (%s, %s)", op, bind(c.Value), bind(c.ID)))
+		}
+	}
+
+	var sql strings.Builder
+	sql.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	if p.SortField == SortByID {
+		fmt.Fprintf(&sql, " ORDER BY id %s", direction)
+	} else {
+		fmt.Fprintf(&sql, " ORDER BY %s %s, id %s", p.SortField, direction, direction)
+	}
+	sql.WriteString(" LIMIT " + bind(p.Limit+1))
+
+	return sql.String(), args, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s using backslash
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Page sizes used when SearchUsers is given no limit or too large a limit
+const (
+	DefaultUserSearchPageSize = 20
+	MaxUserSearchPageSize     = 100
+)
+
+// ErrEmptySearchQuery is returned by SearchUsers when the query has no
+// searchable characters.
+var ErrEmptySearchQuery = errors.New("search query is empty")
+
+// Scores the SQLite and in-memory backends give to substring matches, which
+// stand in for Postgres trigram similarity. The best scoring field ranks the
+// user.
+const (
+	exactMatchRank  = 1.0
+	prefixMatchRank = 0.75
+	substrMatchRank = 0.5
+)
+
+// UserSearchParams selects one page of SearchUsers results
+type UserSearchParams struct {
+	Query  string
+	Limit  int
+	Offset int // number of results skipped, taken from the cursor
+}
+
+// UserSearchResult is a user matching a search. Highlights maps the names of
+// the matching fields to their HTML-escaped values with every occurrence of a
+// query term wrapped in <mark></mark>.
+type UserSearchResult struct {
+	User       *User
+	Rank       float64
+	Highlights map[string]string
+}
+
+// UserSearchPage is a page of search results, best match first, and the
+// cursor of the next page, if any
+type UserSearchPage struct {
+	Results    []*UserSearchResult
+	NextCursor string
+	HasMore    bool
+}
+
+// userSearchCursor is the position of the next page of a search. Results are
+// ordered by rank, which has no stable keyset, so the cursor is an offset
+// tied to the query it was issued for.
+type userSearchCursor struct {
+	Query  string `json:"q"`
+	Offset int    `json:"o"`
+}
+
+// withDefaults normalizes the query and clamps the limit to
+// MaxUserSearchPageSize.
+func (p UserSearchParams) withDefaults() (UserSearchParams, error) {
+	p.Query = strings.Join(strings.Fields(p.Query), " ")
+	if p.Query == "" {
+		return p, ErrEmptySearchQuery
+	}
+
+	if p.Limit <= 0 {
+		p.Limit = DefaultUserSearchPageSize
+	}
+	if p.Limit > MaxUserSearchPageSize {
+		p.Limit = MaxUserSearchPageSize
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+
+	return p, nil
+}
+
+// DecodeSearchCursor returns the offset stored in an opaque cursor issued
+// for the query of p
+func (p UserSearchParams) DecodeSearchCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	c := &userSearchCursor{}
+	query := strings.Join(strings.Fields(p.Query), " ")
+	if err := json.Unmarshal(raw, c); err != nil || c.Query != query || c.Offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return c.Offset, nil
+}
+
+// newUserSearchPage builds a page from up to Limit+1 ranked users; the extra
+// row only signals that another page exists.
+func newUserSearchPage(users []*User, ranks []float64, p UserSearchParams) *UserSearchPage {
+	page := &UserSearchPage{Results: []*UserSearchResult{}}
+	if len(users) > p.Limit {
+		users = users[:p.Limit]
+		page.HasMore = true
+
+		raw, _ := json.Marshal(userSearchCursor{Query: p.Query, Offset: p.Offset + p.Limit})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	for i, user := range users {
+		page.Results = append(page.Results, &UserSearchResult{
+			User:       user,
+			Rank:       ranks[i],
+			Highlights: highlightUser(user, p.Query),
+		})
+	}
+
+	return page
+}
+
+// substringRank scores how well value matches query, ignoring case: an exact
+// match beats a prefix, which beats any other substring.
+func substringRank(value, query string) float64 {
+	value, query = strings.ToLower(value), strings.ToLower(query)
+	switch {
+	case value == query:
+		return exactMatchRank
+	case strings.HasPrefix(value, query):
+		return prefixMatchRank
+	case strings.Contains(value, query):
+		return substrMatchRank
+	default:
+		return 0
+	}
+}
+
+// highlightUser returns the highlighted fields of user that contain a term of
+// query. Fuzzy matches without a literal occurrence are not highlighted.
+func highlightUser(user *User, query string) map[string]string {
+	terms := strings.Fields(query)
+	// Longer terms first, so a term that contains another wins
+	slices.SortFunc(terms, func(a, b string) int { return len(b) - len(a) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+
+	highlights := make(map[string]string)
+	fields := []struct{ name, value string }{
+		{"first_name", user.FirstName},
+		{"last_name", user.LastName},
+		{"email", user.Email},
+		{"phone_number", user.PhoneNumber},
+	}
+	for _, field := range fields {
+		matches := pattern.FindAllStringIndex(field.value, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(html.EscapeString(field.value[last:m[0]]))
+			b.WriteString("<mark>" + html.EscapeString(field.value[m[0]:m[1]]) + "</mark>")
+			last = m[1]
+		}
+		b.WriteString(html.EscapeString(field.value[last:]))
+		highlights[field.name] = b.String()
+	}
+
+	return highlights
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// MaxStatusReasonLength is the longest reason accepted for a status change
+const MaxStatusReasonLength = 500
+
+// UserStatusChange records an admin changing the status of a user
+type UserStatusChange struct {
+	ID        int64
+	UserID    int64
+	OldStatus string // set by ChangeUserStatus
+	NewStatus string
+	Reason    string
+	ChangedBy int64 // ID of the admin, 0 once that admin has been purged
+	CreatedAt time.Time
+}
@@ -1,21 +1,31 @@
 package models
 
 import (
-	"os"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/masudcsesust04/golang-jwt-auth/internal/config"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/audit"
 )
 
-func TestMain(m *testing.M) {
-	cleanup := config.SetupTestDB(m)
-	defer cleanup()
-
-	os.Exit(m.Run())
+func newTestUser(email, phone string) *User {
+	return &User{
+		FirstName:   "Test",
+		LastName:    "User",
+		PhoneNumber: phone,
+		Email:       email,
+		Status:      StatusActive,
+		Password:    "password123",
+	}
 }
 
-func TestCreateAndGetUser(t *testing.T) {
+func testCreateAndGetUser(t *testing.T, store Store) {
+	ctx := context.Background()
 	user := &User{
 		FirstName:   "Test",
 		LastName:    "User",
@@ -25,13 +35,13 @@ func TestCreateAndGetUser(t *testing.T) {
 		Password:    "password123",
 	}
 
-	err := user.RegisterUser(user)
+	err := store.RegisterUser(ctx, user)
 	if err != nil {
 		t.Fatalf("CreateUser failed: %v", err)
 	}
 
 	// Use GetUserByEmail instead of GetUserByUsername
-	gotUser, err := user.GetUserByEmail(user.Email)
+	gotUser, err := store.GetUserByEmail(ctx, user.Email)
 	if err != nil {
 		t.Fatalf("GetUserByEmail failed: %v", err)
 	}
@@ -40,7 +50,8 @@ func TestCreateAndGetUser(t *testing.T) {
 	}
 }
 
-func TestUpdateUser(t *testing.T) {
+func testUpdateUser(t *testing.T, store Store) {
+	ctx := context.Background()
 	user := &User{
 		FirstName:   "Update",
 		LastName:    "User",
@@ -50,27 +61,38 @@ func TestUpdateUser(t *testing.T) {
 		Password:    "password123",
 	}
 
-	err := user.RegisterUser(user)
+	err := store.RegisterUser(ctx, user)
 	if err != nil {
 		t.Fatalf("CreateUser failed: %v", err)
 	}
 
+	createdAt := user.UpdatedAt
+	time.Sleep(2 * time.Millisecond)
+
 	user.Email = "newemail@example.com"
-	err = user.UpdateUser(user)
+	user.Role = RoleAdmin
+	err = store.UpdateUser(ctx, user)
 	if err != nil {
 		t.Fatalf("UpdateUser failed: %v", err)
 	}
 
-	updatedUser, err := user.GetUserByID(user.ID)
+	updatedUser, err := store.GetUserByID(ctx, user.ID)
 	if err != nil {
 		t.Fatalf("GetUserByID failed: %v", err)
 	}
 	if updatedUser.Email != "newemail@example.com" {
 		t.Fatalf("UpdateUser did not update email")
 	}
+	if updatedUser.Role != RoleAdmin {
+		t.Fatalf("UpdateUser did not update role")
+	}
+	if !updatedUser.UpdatedAt.After(createdAt) || !updatedUser.UpdatedAt.Equal(user.UpdatedAt) {
+		t.Fatalf("UpdateUser did not bump updated_at: created %v, stored %v, returned %v", createdAt, updatedUser.UpdatedAt, user.UpdatedAt)
+	}
 }
 
-func TestDeleteUser(t *testing.T) {
+func testDeleteUser(t *testing.T, store Store) {
+	ctx := context.Background()
 	user := &User{
 		FirstName:   "Delete",
 		LastName:    "User",
@@ -80,23 +102,29 @@ func TestDeleteUser(t *testing.T) {
 		Password:    "password123",
 	}
 
-	err := user.RegisterUser(user)
+	err := store.RegisterUser(ctx, user)
 	if err != nil {
 		t.Fatalf("CreateUser failed: %v", err)
 	}
 
-	err = user.DeleteUser(user.ID)
+	err = store.DeleteUser(ctx, user.ID)
 	if err != nil {
 		t.Fatalf("DeleteUser failed: %v", err)
 	}
 
-	deletedUser, err := user.GetUserByID(user.ID)
+	deletedUser, err := store.GetUserByID(ctx, user.ID)
 	if err == nil && deletedUser != nil {
 		t.Fatalf("DeleteUser did not delete user")
 	}
+
+	// A deleted user cannot be deleted again
+	if err := store.DeleteUser(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a deleted user, got %v", err)
+	}
 }
 
-func TestCreateAndDeleteRefreshToken(t *testing.T) {
+func testCreateAndDeleteRefreshToken(t *testing.T, store Store) {
+	ctx := context.Background()
 	user := &User{
 		FirstName:   "Token",
 		LastName:    "User",
@@ -105,7 +133,7 @@ func TestCreateAndDeleteRefreshToken(t *testing.T) {
 		Password:    "password123",
 	}
 
-	err := user.RegisterUser(user)
+	err := store.RegisterUser(ctx, user)
 	if err != nil {
 		t.Fatalf("CreateUser failed: %v", err)
 	}
@@ -117,12 +145,12 @@ func TestCreateAndDeleteRefreshToken(t *testing.T) {
 		CreatedAt: time.Now(),
 	}
 
-	err = user.CreateRefreshToken(rt)
+	err = store.CreateRefreshToken(ctx, rt)
 	if err != nil {
 		t.Fatalf("CreateRefreshToken failed: %v", err)
 	}
 
-	gotRT, err := user.GetRefreshToken(rt.UserID)
+	gotRT, err := store.GetRefreshToken(ctx, rt.UserID)
 	if err != nil {
 		t.Fatalf("GetRefreshToken failed: %v", err)
 	}
@@ -130,24 +158,865 @@ func TestCreateAndDeleteRefreshToken(t *testing.T) {
 		t.Fatalf("GetRefreshToken returned wrong token")
 	}
 
-	err = user.DeleteRefreshToken(rt.UserID)
+	err = store.DeleteRefreshToken(ctx, rt.UserID)
 	if err != nil {
 		t.Fatalf("DeleteRefreshToken failed: %v", err)
 	}
 
-	deletedRT, err := user.GetRefreshToken(rt.UserID)
+	deletedRT, err := store.GetRefreshToken(ctx, rt.UserID)
 	if err == nil && deletedRT != nil {
 		t.Fatalf("DeleteRefreshToken did not delete token")
 	}
 }
 
-func TestGetAllUsers(t *testing.T) {
-	user := &User{}
-	users, err := user.GetAllUsers()
+func testListUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	if err := store.RegisterUser(ctx, newTestUser("listuser@example.com", "7778889999")); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	page, err := store.ListUsers(ctx, UserListParams{})
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(page.Users) == 0 {
+		t.Fatalf("ListUsers returned empty list")
+	}
+}
+
+func testListUsersPagination(t *testing.T, store Store) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		user := newTestUser(fmt.Sprintf("page%d@example.com", i), fmt.Sprintf("55500%d", i))
+		if err := store.RegisterUser(ctx, user); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	for _, sort := range []string{"id:asc", "id:desc", "created_at:asc", "created_at:desc", "email:asc", "email:desc"} {
+		field, desc, err := ParseUserSort(sort)
+		if err != nil {
+			t.Fatalf("ParseUserSort(%q) failed: %v", sort, err)
+		}
+		params := UserListParams{SortField: field, SortDesc: desc, Limit: 2}
+
+		var seen []int64
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("%s: pagination did not terminate", sort)
+			}
+			page, err := store.ListUsers(ctx, params)
+			if err != nil {
+				t.Fatalf("%s: ListUsers failed: %v", sort, err)
+			}
+			for _, user := range page.Users {
+				seen = append(seen, user.ID)
+			}
+			if !page.HasMore {
+				break
+			}
+			if params.Cursor, err = params.DecodeUserCursor(page.NextCursor); err != nil {
+				t.Fatalf("%s: DecodeUserCursor failed: %v", sort, err)
+			}
+		}
+
+		if len(seen) != 5 {
+			t.Fatalf("%s: expected 5 users across pages, got %v", sort, seen)
+		}
+		for i := 1; i < len(seen); i++ {
+			if field == SortByID && desc != (seen[i] < seen[i-1]) {
+				t.Fatalf("%s: users out of order: %v", sort, seen)
+			}
+			if seen[i] == seen[i-1] {
+				t.Fatalf("%s: user repeated across pages: %v", sort, seen)
+			}
+		}
+	}
+}
+
+func testListUsersFilters(t *testing.T, store Store) {
+	ctx := context.Background()
+	active := newTestUser("Alice.Filter@example.com", "910")
+	banned := newTestUser("bob_filter@example.com", "911")
+	banned.Status = StatusBanned
+	for _, user := range []*User{active, banned} {
+		if err := store.RegisterUser(ctx, user); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	page, err := store.ListUsers(ctx, UserListParams{Status: StatusBanned})
+	if err != nil || len(page.Users) != 1 || page.Users[0].ID != banned.ID {
+		t.Fatalf("status filter returned %v, err %v", page, err)
+	}
+
+	page, err = store.ListUsers(ctx, UserListParams{EmailContains: "alice.FILTER"})
+	if err != nil || len(page.Users) != 1 || page.Users[0].ID != active.ID {
+		t.Fatalf("email_contains filter returned %v, err %v", page, err)
+	}
+
+	// LIKE wildcards in the filter are matched literally
+	page, err = store.ListUsers(ctx, UserListParams{EmailContains: "_filter"})
+	if err != nil || len(page.Users) != 1 || page.Users[0].ID != banned.ID {
+		t.Fatalf("email_contains with wildcard returned %v, err %v", page, err)
+	}
+
+	page, err = store.ListUsers(ctx, UserListParams{CreatedAfter: time.Now().Add(time.Hour)})
+	if err != nil || len(page.Users) != 0 {
+		t.Fatalf("created_after filter returned %v, err %v", page, err)
+	}
+}
+
+func testSearchUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	smith := newTestUser("jsmith@example.com", "5550101")
+	smith.FirstName, smith.LastName = "John", "Smith"
+	smithson := newTestUser("smithson@example.com", "7771234")
+	smithson.FirstName, smithson.LastName = "Anna", "Smithson"
+	other := newTestUser("other@example.com", "9998877")
+	other.FirstName, other.LastName = "Mary", "Jones"
+	for _, user := range []*User{smith, smithson, other} {
+		if err := store.RegisterUser(ctx, user); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	page, err := store.SearchUsers(ctx, UserSearchParams{Query: "  SMITH "})
+	if err != nil {
+		t.Fatalf("SearchUsers failed: %v", err)
+	}
+	found := make(map[int64]*UserSearchResult)
+	for i, result := range page.Results {
+		found[result.User.ID] = result
+		if i > 0 && result.Rank > page.Results[i-1].Rank {
+			t.Errorf("results not ordered by rank: %v after %v", result.Rank, page.Results[i-1].Rank)
+		}
+		if result.User.PasswordHash != "" {
+			t.Errorf("SearchUsers returned a password hash")
+		}
+	}
+	if found[smith.ID] == nil || found[smithson.ID] == nil || found[other.ID] != nil {
+		t.Fatalf("expected both Smiths and no one else, got %d results", len(page.Results))
+	}
+	if got := found[smith.ID].Highlights["last_name"]; got != "<mark>Smith</mark>" {
+		t.Errorf("expected highlighted last name, got %q", got)
+	}
+	if got := found[smithson.ID].Highlights["email"]; got != "<mark>smith</mark>son@example.com" {
+		t.Errorf("expected highlighted email, got %q", got)
+	}
+
+	// Phone numbers match too
+	page, err = store.SearchUsers(ctx, UserSearchParams{Query: "9998877"})
+	if err != nil || len(page.Results) != 1 || page.Results[0].User.ID != other.ID {
+		t.Fatalf("phone search returned %v, err %v", page, err)
+	}
+
+	if _, err := store.SearchUsers(ctx, UserSearchParams{Query: "   "}); !errors.Is(err, ErrEmptySearchQuery) {
+		t.Errorf("expected ErrEmptySearchQuery, got %v", err)
+	}
+}
+
+func testSearchUsersPagination(t *testing.T, store Store) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		user := newTestUser(fmt.Sprintf("searchpage%d@example.com", i), fmt.Sprintf("6%d", i))
+		if err := store.RegisterUser(ctx, user); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	params := UserSearchParams{Query: "searchpage", Limit: 2}
+	seen := make(map[int64]bool)
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("pagination did not terminate")
+		}
+		page, err := store.SearchUsers(ctx, params)
+		if err != nil {
+			t.Fatalf("SearchUsers failed: %v", err)
+		}
+		for _, result := range page.Results {
+			if seen[result.User.ID] {
+				t.Fatalf("user %d returned twice", result.User.ID)
+			}
+			seen[result.User.ID] = true
+		}
+		if !page.HasMore {
+			break
+		}
+		if params.Offset, err = params.DecodeSearchCursor(page.NextCursor); err != nil {
+			t.Fatalf("DecodeSearchCursor failed: %v", err)
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 users across pages, got %d", len(seen))
+	}
+}
+
+func testRoles(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("role@example.com", "920")
+	admin := newTestUser("admin@example.com", "921")
+	admin.Role = RoleAdmin
+	for _, u := range []*User{user, admin} {
+		if err := store.RegisterUser(ctx, u); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	got, err := store.GetUserByID(ctx, user.ID)
+	if err != nil || got.Role != RoleUser {
+		t.Fatalf("expected default role %q, got %v, err %v", RoleUser, got, err)
+	}
+	got, err = store.GetUserByEmail(ctx, admin.Email)
+	if err != nil || got.Role != RoleAdmin {
+		t.Fatalf("expected role %q, got %v, err %v", RoleAdmin, got, err)
+	}
+}
+
+func testOptimisticLocking(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("version@example.com", "930")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	if user.Version != 1 {
+		t.Fatalf("expected new user at version 1, got %d", user.Version)
+	}
+
+	first, _ := store.GetUserByID(ctx, user.ID)
+	second, _ := store.GetUserByID(ctx, user.ID)
+
+	first.FirstName = "First"
+	if err := store.UpdateUser(ctx, first); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if first.Version != 2 {
+		t.Fatalf("expected version 2 after update, got %d", first.Version)
+	}
+
+	// second was read before the update and must not overwrite it
+	second.FirstName = "Second"
+	if err := store.UpdateUser(ctx, second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+
+	stored, _ := store.GetUserByID(ctx, user.ID)
+	if stored.FirstName != "First" || stored.Version != 2 {
+		t.Fatalf("expected first update to win, got %q at version %d", stored.FirstName, stored.Version)
+	}
+
+	// Without a version the update is unconditional
+	second.Version = 0
+	if err := store.UpdateUser(ctx, second); err != nil || second.Version != 3 {
+		t.Fatalf("unconditional update returned version %d, err %v", second.Version, err)
+	}
+
+	// A versioned update of a missing or deleted user is not a conflict
+	missing := *second
+	missing.ID = 999999
+	if err := store.UpdateUser(ctx, &missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound updating a missing user, got %v", err)
+	}
+	if err := store.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if err := store.UpdateUser(ctx, second); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound updating a deleted user, got %v", err)
+	}
+}
+
+func testSoftDelete(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("softdelete@example.com", "940")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	if err := store.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	if _, err := store.GetUserByID(ctx, user.ID); err == nil {
+		t.Errorf("GetUserByID returned a deleted user")
+	}
+	if _, err := store.GetUserByEmail(ctx, user.Email); err == nil {
+		t.Errorf("GetUserByEmail returned a deleted user")
+	}
+	page, err := store.ListUsers(ctx, UserListParams{EmailContains: "softdelete"})
+	if err != nil || len(page.Users) != 0 {
+		t.Errorf("ListUsers returned %v, err %v", page, err)
+	}
+	results, err := store.SearchUsers(ctx, UserSearchParams{Query: "softdelete"})
+	if err != nil || len(results.Results) != 0 {
+		t.Errorf("SearchUsers returned %v, err %v", results, err)
+	}
+	user.FirstName = "Changed"
+	user.Version = 0
+	if err := store.UpdateUser(ctx, user); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted user, got %v", err)
+	}
+
+	// The email and phone number stay taken until the user is purged
+	if err := store.RegisterUser(ctx, newTestUser("softdelete@example.com", "941")); err == nil {
+		t.Errorf("RegisterUser reused the email of a deleted user")
+	}
+
+	if err := store.RestoreUser(ctx, user.ID); err != nil {
+		t.Fatalf("RestoreUser failed: %v", err)
+	}
+	restored, err := store.GetUserByID(ctx, user.ID)
+	if err != nil || restored.FirstName != "Test" {
+		t.Fatalf("restored user is %v, err %v", restored, err)
+	}
+	if err := store.RestoreUser(ctx, user.ID); !errors.Is(err, ErrUserNotDeleted) {
+		t.Errorf("expected ErrUserNotDeleted restoring an active user, got %v", err)
+	}
+	if err := store.RestoreUser(ctx, 999999); !errors.Is(err, ErrUserNotDeleted) {
+		t.Errorf("expected ErrUserNotDeleted restoring a missing user, got %v", err)
+	}
+}
+
+func testPurgeDeletedUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	deleted := newTestUser("purged@example.com", "950")
+	active := newTestUser("kept@example.com", "951")
+	for _, user := range []*User{deleted, active} {
+		if err := store.RegisterUser(ctx, user); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+	if err := store.DeleteUser(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	// Users deleted after the cutoff are kept
+	purged, err := store.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+	if err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged, got %d, err %v", purged, err)
+	}
+
+	purged, err = store.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("expected one user purged, got %d, err %v", purged, err)
+	}
+	if err := store.RestoreUser(ctx, deleted.ID); !errors.Is(err, ErrUserNotDeleted) {
+		t.Errorf("expected a purged user to be gone, got %v", err)
+	}
+	if _, err := store.GetUserByID(ctx, active.ID); err != nil {
+		t.Errorf("PurgeDeletedUsers removed an active user: %v", err)
+	}
+
+	// A purged user's email can be registered again
+	if err := store.RegisterUser(ctx, newTestUser("purged@example.com", "952")); err != nil {
+		t.Errorf("RegisterUser failed after purge: %v", err)
+	}
+}
+
+func testUniqueConstraints(t *testing.T, store Store) {
+	ctx := context.Background()
+	if err := store.RegisterUser(ctx, newTestUser("a@example.com", "100")); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	if err := store.RegisterUser(ctx, newTestUser("a@example.com", "200")); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected ErrDuplicateEmail for a duplicate email, got %v", err)
+	}
+	if err := store.RegisterUser(ctx, newTestUser("b@example.com", "100")); !errors.Is(err, ErrDuplicatePhone) {
+		t.Fatalf("expected ErrDuplicatePhone for a duplicate phone number, got %v", err)
+	}
+
+	other := newTestUser("b@example.com", "200")
+	if err := store.RegisterUser(ctx, other); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	other.Email = "a@example.com"
+	if err := store.UpdateUser(ctx, other); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected ErrDuplicateEmail updating to a taken email, got %v", err)
+	}
+}
+
+func testStatusCheck(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("status@example.com", "300")
+	user.Status = "unknown"
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	if user.Status != StatusActive {
+		t.Fatalf("expected invalid status to default to active, got %q", user.Status)
+	}
+
+	user.Status = "deleted"
+	if err := store.UpdateUser(ctx, user); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("expected ErrInvalidValue for an invalid status, got %v", err)
+	}
+}
+
+func testColumnLengths(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("length@example.com", "301")
+	user.FirstName = strings.Repeat("x", 21)
+	if err := store.RegisterUser(ctx, user); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("expected ErrInvalidValue for a first name longer than 20 characters, got %v", err)
+	}
+}
+
+func testDeleteUserCascades(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("cascade@example.com", "400")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+
+	rt := &RefreshToken{UserID: user.ID, Token: fmt.Sprintf("token%d", user.ID), ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if err := store.CreateRefreshToken(ctx, rt); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+
+	if err := store.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteUser did not delete refresh tokens: %v", err)
+	}
+
+	// Soft deleted users keep their row until purged
+	if _, err := store.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedUsers failed: %v", err)
+	}
+	if err := store.CreateRefreshToken(ctx, &RefreshToken{UserID: user.ID, Token: "other", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound creating a refresh token for an unknown user, got %v", err)
+	}
+}
+
+func testHidesPasswordHash(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("hash@example.com", "500")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+
+	byEmail, err := store.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail failed: %v", err)
+	}
+	if byEmail.PasswordHash == "" {
+		t.Fatalf("GetUserByEmail should return the password hash")
+	}
+
+	byID, err := store.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if byID.PasswordHash != "" || byID.Password != "" {
+		t.Fatalf("GetUserByID leaked password data")
+	}
+}
+
+func testExpiredRefreshToken(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("expired@example.com", "600")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+
+	rt := &RefreshToken{UserID: user.ID, Token: "expired", ExpiresAt: time.Now().Add(-time.Minute), CreatedAt: time.Now().Add(-time.Hour)}
+	if err := store.CreateRefreshToken(ctx, rt); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, user.ID); err == nil {
+		t.Fatalf("GetRefreshToken returned an expired token")
+	}
+}
+
+func testWithTxCommit(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("txcommit@example.com", "700")
+
+	err := store.WithTx(ctx, func(tx Store) error {
+		if err := tx.RegisterUser(ctx, user); err != nil {
+			return err
+		}
+		return tx.CreateRefreshToken(ctx, &RefreshToken{UserID: user.ID, Token: "tx-token", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()})
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+
+	if _, err := store.GetUserByEmail(ctx, user.Email); err != nil {
+		t.Fatalf("committed user not found: %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, user.ID); err != nil {
+		t.Fatalf("committed refresh token not found: %v", err)
+	}
+}
+
+func testWithTxRollback(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("txrollback@example.com", "800")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+
+	err := store.WithTx(ctx, func(tx Store) error {
+		if err := tx.DeleteUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.RegisterUser(ctx, newTestUser("txrollback2@example.com", "801")); err != nil {
+			return err
+		}
+		// Fails on the unique phone number and aborts the whole transaction
+		return tx.RegisterUser(ctx, newTestUser("txrollback3@example.com", "801"))
+	})
+	if err == nil {
+		t.Fatalf("WithTx should return the error from fn")
+	}
+
+	if _, err := store.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatalf("rolled back delete removed the user: %v", err)
+	}
+	if _, err := store.GetUserByEmail(ctx, "txrollback2@example.com"); err == nil {
+		t.Fatalf("rolled back insert is visible")
+	}
+}
+
+func testWithTxNested(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := newTestUser("txnested@example.com", "900")
+
+	err := store.WithTx(ctx, func(tx Store) error {
+		return tx.WithTx(ctx, func(inner Store) error {
+			return inner.RegisterUser(ctx, user)
+		})
+	})
+	if err != nil {
+		t.Fatalf("nested WithTx failed: %v", err)
+	}
+	if _, err := store.GetUserByEmail(ctx, user.Email); err != nil {
+		t.Fatalf("user from nested transaction not found: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.GetUserByID(ctx, 999999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from GetUserByID, got %v", err)
+	}
+	if _, err := store.GetUserByEmail(ctx, "missing@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from GetUserByEmail, got %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, 999999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from GetRefreshToken, got %v", err)
+	}
+	missing := newTestUser("missing@example.com", "990")
+	missing.ID, missing.Role = 999999, RoleUser
+	if err := store.UpdateUser(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from UpdateUser, got %v", err)
+	}
+	if err := store.DeleteUser(ctx, 999999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from DeleteUser, got %v", err)
+	}
+}
+
+func testUserStatusChanges(t *testing.T, store Store) {
+	ctx := context.Background()
+	admin := newTestUser("status-admin@example.com", "960")
+	admin.Role = RoleAdmin
+	user := newTestUser("status-user@example.com", "961")
+	for _, u := range []*User{admin, user} {
+		if err := store.RegisterUser(ctx, u); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+	rt := &RefreshToken{UserID: user.ID, Token: "status-token", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if err := store.CreateRefreshToken(ctx, rt); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+
+	ban := &UserStatusChange{UserID: user.ID, NewStatus: StatusBanned, Reason: "spam", ChangedBy: admin.ID}
+	if err := store.ChangeUserStatus(ctx, ban); err != nil {
+		t.Fatalf("ChangeUserStatus failed: %v", err)
+	}
+	if ban.ID == 0 || ban.OldStatus != StatusActive || ban.CreatedAt.IsZero() {
+		t.Errorf("ChangeUserStatus did not fill in the change: %+v", ban)
+	}
+
+	got, err := store.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if got.Status != StatusBanned || got.Version != 2 {
+		t.Errorf("expected a banned user at version 2, got %q at %d", got.Status, got.Version)
+	}
+	if _, err := store.GetRefreshToken(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected banning to revoke refresh tokens, got %v", err)
+	}
+
+	// Reactivating keeps sessions created since
+	if err := store.CreateRefreshToken(ctx, &RefreshToken{UserID: user.ID, Token: "status-token-2", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	if err := store.ChangeUserStatus(ctx, &UserStatusChange{UserID: user.ID, NewStatus: StatusActive, Reason: "appeal", ChangedBy: admin.ID}); err != nil {
+		t.Fatalf("ChangeUserStatus failed: %v", err)
+	}
+	if _, err := store.GetRefreshToken(ctx, user.ID); err != nil {
+		t.Errorf("reactivating revoked refresh tokens: %v", err)
+	}
+
+	changes, err := store.ListUserStatusChanges(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListUserStatusChanges failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 status changes, got %d", len(changes))
+	}
+	if c := changes[1]; c.ID != ban.ID || c.UserID != user.ID || c.OldStatus != StatusActive || c.NewStatus != StatusBanned || c.Reason != "spam" || c.ChangedBy != admin.ID {
+		t.Errorf("unexpected oldest change %+v", c)
+	}
+	if c := changes[0]; c.OldStatus != StatusBanned || c.NewStatus != StatusActive || c.Reason != "appeal" {
+		t.Errorf("unexpected newest change %+v", c)
+	}
+
+	if err := store.ChangeUserStatus(ctx, &UserStatusChange{UserID: 999999, NewStatus: StatusBanned, Reason: "x", ChangedBy: admin.ID}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing user, got %v", err)
+	}
+	if err := store.ChangeUserStatus(ctx, &UserStatusChange{UserID: user.ID, NewStatus: "deleted", Reason: "x", ChangedBy: admin.ID}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for an invalid status, got %v", err)
+	}
+	if err := store.ChangeUserStatus(ctx, &UserStatusChange{UserID: user.ID, NewStatus: StatusBanned, Reason: strings.Repeat("x", MaxStatusReasonLength+1), ChangedBy: admin.ID}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected ErrInvalidValue for a reason that is too long, got %v", err)
+	}
+
+	// Purging the admin keeps the history without the actor; purging the
+	// user removes it
+	if err := store.DeleteUser(ctx, admin.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := store.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedUsers failed: %v", err)
+	}
+	changes, err = store.ListUserStatusChanges(ctx, user.ID)
+	if err != nil || len(changes) != 2 || changes[0].ChangedBy != 0 {
+		t.Errorf("expected the history without the purged admin, got %v, err %v", changes, err)
+	}
+	if err := store.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := store.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedUsers failed: %v", err)
+	}
+	if changes, err = store.ListUserStatusChanges(ctx, user.ID); err != nil || len(changes) != 0 {
+		t.Errorf("expected the history of a purged user to be removed, got %v, err %v", changes, err)
+	}
+}
+
+func testAuditEvents(t *testing.T, store Store) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+
+	events := []*audit.Event{
+		{Action: audit.ActionLoginFailed, IP: "192.0.2.1", UserAgent: "curl/8.0", RequestID: "req-1"},
+		{Action: audit.ActionLogin, ActorID: 7, TargetID: 7, IP: "192.0.2.1", UserAgent: "curl/8.0", RequestID: "req-2"},
+		{Action: audit.ActionUserUpdate, ActorID: 7, TargetID: 8, IP: "2001:db8::1", Diff: json.RawMessage(`{"email":{"old":"a@example.com","new":"b@example.com"}}`)},
+	}
+	for _, event := range events {
+		if err := store.AppendAuditEvent(ctx, event); err != nil {
+			t.Fatalf("AppendAuditEvent failed: %v", err)
+		}
+		if event.ID == 0 || event.Hash == "" || event.OccurredAt.IsZero() {
+			t.Fatalf("AppendAuditEvent did not seal the event: %+v", event)
+		}
+	}
+	if events[0].PrevHash != "" || events[1].PrevHash != events[0].Hash || events[2].PrevHash != events[1].Hash {
+		t.Errorf("events are not chained: %+v", events)
+	}
+
+	// A rolled back transaction leaves no event and no gap in the chain
+	rollback := errors.New("rollback")
+	err := store.WithTx(ctx, func(tx Store) error {
+		if err := tx.AppendAuditEvent(ctx, &audit.Event{Action: audit.ActionLogout}); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected the rollback error, got %v", err)
+	}
+
+	page, err := store.ListAuditEvents(ctx, audit.Filter{})
 	if err != nil {
-		t.Fatalf("GetAllUsers failed: %v", err)
+		t.Fatalf("ListAuditEvents failed: %v", err)
+	}
+	if len(page.Events) != 3 || page.HasMore {
+		t.Fatalf("expected 3 events on one page, got %d", len(page.Events))
 	}
-	if len(users) == 0 {
-		t.Fatalf("GetAllUsers returned empty list")
+	got := page.Events[0]
+	if got.ID != events[2].ID || got.ActorID != 7 || got.TargetID != 8 || got.IP != "2001:db8::1" || got.Hash != events[2].Hash || !got.OccurredAt.Equal(events[2].OccurredAt) {
+		t.Errorf("unexpected newest event %+v", got)
+	}
+	if string(got.Diff) != string(events[2].Diff) || page.Events[1].Diff != nil {
+		t.Errorf("diffs were not stored as is: %s, %s", got.Diff, page.Events[1].Diff)
+	}
+	if page.Events[2].ActorID != 0 || page.Events[2].TargetID != 0 {
+		t.Errorf("expected no actor or target, got %+v", page.Events[2])
+	}
+
+	checked, err := audit.Verify(ctx, store)
+	if err != nil || checked != 3 {
+		t.Errorf("expected a valid chain of 3 events, got %d, err %v", checked, err)
+	}
+
+	filters := []struct {
+		name   string
+		filter audit.Filter
+		ids    []int64
+	}{
+		{"actor", audit.Filter{ActorID: 7}, []int64{events[2].ID, events[1].ID}},
+		{"target", audit.Filter{TargetID: 8}, []int64{events[2].ID}},
+		{"action", audit.Filter{Action: audit.ActionLoginFailed}, []int64{events[0].ID}},
+		{"since", audit.Filter{Since: start}, []int64{events[2].ID, events[1].ID, events[0].ID}},
+		{"until", audit.Filter{Until: start}, nil},
+		{"before", audit.Filter{BeforeID: events[1].ID}, []int64{events[0].ID}},
+	}
+	for _, tc := range filters {
+		page, err := store.ListAuditEvents(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: ListAuditEvents failed: %v", tc.name, err)
+		}
+		var ids []int64
+		for _, event := range page.Events {
+			ids = append(ids, event.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tc.ids) {
+			t.Errorf("%s: expected events %v, got %v", tc.name, tc.ids, ids)
+		}
+	}
+
+	page, err = store.ListAuditEvents(ctx, audit.Filter{Limit: 2})
+	if err != nil || len(page.Events) != 2 || !page.HasMore || page.NextCursor == "" {
+		t.Fatalf("expected a first page of 2 events with a cursor, got %+v, err %v", page, err)
+	}
+	before, err := audit.DecodeCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	page, err = store.ListAuditEvents(ctx, audit.Filter{Limit: 2, BeforeID: before})
+	if err != nil || len(page.Events) != 1 || page.HasMore || page.Events[0].ID != events[0].ID {
+		t.Errorf("expected the last page to hold the oldest event, got %+v, err %v", page, err)
+	}
+}
+
+func testConcurrentAuditAppends(t *testing.T, store Store) {
+	ctx := context.Background()
+	const logins = 10
+
+	users := make([]*User, logins)
+	for i := range users {
+		users[i] = newTestUser(fmt.Sprintf("login%d@example.com", i), fmt.Sprintf("55500000%02d", i))
+		if err := store.RegisterUser(ctx, users[i]); err != nil {
+			t.Fatalf("RegisterUser failed: %v", err)
+		}
+	}
+
+	// Each login stores a refresh token and appends to the chain in one
+	// transaction, as the login handler does
+	errs := make(chan error, logins)
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.WithTx(WithAuditAppend(ctx), func(tx Store) error {
+				err := tx.CreateRefreshToken(ctx, &RefreshToken{UserID: user.ID, Token: fmt.Sprintf("token%d", user.ID), ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()})
+				if err != nil {
+					return err
+				}
+				return tx.AppendAuditEvent(ctx, &audit.Event{Action: audit.ActionLogin, ActorID: user.ID, TargetID: user.ID})
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent login failed: %v", err)
+		}
+	}
+
+	checked, err := audit.Verify(ctx, store)
+	if err != nil || checked != logins {
+		t.Errorf("expected an unbroken chain of %d events, got %d, err %v", logins, checked, err)
+	}
+}
+
+// testAuditLockScope checks that a transaction appending to the audit chain
+// does not block writes that do not append, and that an append the
+// transaction was not marked for still extends the chain
+func testAuditLockScope(t *testing.T, store Store) {
+	if _, ok := store.(*User); !ok {
+		t.Skip("only the Postgres store locks the audit chain; the others run one transaction at a time")
+	}
+	ctx := context.Background()
+	user := newTestUser("lockscope@example.com", "970")
+	if err := store.RegisterUser(ctx, user); err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+
+	// Hold the chain lock in an open transaction
+	appended := make(chan struct{}, 1)
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- store.WithTx(WithAuditAppend(ctx), func(tx Store) error {
+			if err := tx.AppendAuditEvent(ctx, &audit.Event{Action: audit.ActionLogin, ActorID: user.ID, TargetID: user.ID}); err != nil {
+				return err
+			}
+			appended <- struct{}{}
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-appended:
+	case err := <-done:
+		t.Fatalf("appending transaction failed: %v", err)
+	}
+
+	writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	other := newTestUser("lockscope-other@example.com", "971")
+	if err := store.RegisterUser(writeCtx, other); err != nil {
+		t.Errorf("RegisterUser waited on the audit chain: %v", err)
+	}
+	err := store.WithTx(writeCtx, func(tx Store) error {
+		other.FirstName = "Unblocked"
+		return tx.UpdateUser(writeCtx, other)
+	})
+	if err != nil {
+		t.Errorf("transaction without an audit event waited on the audit chain: %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("appending transaction failed: %v", err)
+	}
+
+	// Appending after another statement without WithAuditAppend is retried
+	// with the lock taken first
+	calls := 0
+	err = store.WithTx(ctx, func(tx Store) error {
+		calls++
+		if _, err := tx.GetUserByID(ctx, user.ID); err != nil {
+			return err
+		}
+		return tx.AppendAuditEvent(ctx, &audit.Event{Action: audit.ActionLogout, ActorID: user.ID, TargetID: user.ID})
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("late append ran %d times, err %v", calls, err)
+	}
+
+	checked, err := audit.Verify(ctx, store)
+	if err != nil || checked != 2 {
+		t.Errorf("expected an unbroken chain of 2 events, got %d, err %v", checked, err)
 	}
 }
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GenerateFromPassword is bcrypt.GenerateFromPassword in a "bcrypt.hash" span,
+// as hashing is deliberately slow
+func GenerateFromPassword(ctx context.Context, password []byte, cost int) ([]byte, error) {
+	_, span := Tracer().Start(ctx, "bcrypt.hash", trace.WithAttributes(attribute.Int("bcrypt.cost", cost)))
+	defer span.End()
+
+	return bcrypt.GenerateFromPassword(password, cost)
+}
+
+// CompareHashAndPassword is bcrypt.CompareHashAndPassword in a
+// "bcrypt.compare" span. A mismatch is an expected outcome, so it is recorded
+// as an attribute rather than a span error.
+func CompareHashAndPassword(ctx context.Context, hashedPassword, password []byte) error {
+	_, span := Tracer().Start(ctx, "bcrypt.compare")
+	defer span.End()
+
+	if cost, err := bcrypt.Cost(hashedPassword); err == nil {
+		span.SetAttributes(attribute.Int("bcrypt.cost", cost))
+	}
+	err := bcrypt.CompareHashAndPassword(hashedPassword, password)
+	span.SetAttributes(attribute.Bool("bcrypt.match", err == nil))
+	return err
+}
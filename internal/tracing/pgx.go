@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer is a pgx.QueryTracer that records a client span for each
+// query. Set it as the Tracer of the pool's ConnConfig. Query arguments are
+// never recorded, as they include password hashes and tokens.
+type QueryTracer struct{}
+
+var _ pgx.QueryTracer = QueryTracer{}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db."+queryOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(data.SQL),
+			attribute.Int("db.query.args", len(data.Args)),
+		),
+	)
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// queryOperation returns the lower-cased first keyword of sql, such as
+// "select" or "with", to name the span without high-cardinality text
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToLower(fields[0])
+}
@@ -0,0 +1,95 @@
+// Package tracing configures OpenTelemetry tracing for the server. Spans are
+// created for each matched route, each PostgreSQL query and each bcrypt
+// operation, and W3C trace context is propagated from incoming requests.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the server in traces and names its tracer
+const ServiceName = "golang-jwt-auth"
+
+// Exporters accepted by Setup
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Options configure Setup
+type Options struct {
+	// Exporter is "otlp", which exports over OTLP/HTTP, "stdout", which
+	// prints spans for local use, or "none", which disables tracing
+	Exporter string
+	// OTLPEndpoint is the URL of the OTLP collector. When empty the standard
+	// OTEL_EXPORTER_OTLP_* environment variables apply.
+	OTLPEndpoint string
+	// SampleRatio is the fraction of new traces sampled. Traces started
+	// upstream follow the caller's decision.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider described by opts and the W3C
+// trace context and baggage propagators. The returned function flushes and
+// stops the provider.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(opts.Exporter) {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var otlpOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		spanExporter, err = otlptracehttp.New(ctx, otlpOpts...)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the server. It uses the global provider at
+// the time of the call, so spans are dropped until Setup installs one.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordSpans installs a provider that keeps ended spans in memory for the
+// duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestBcryptSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx := context.Background()
+
+	hash, err := GenerateFromPassword(ctx, []byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword failed: %v", err)
+	}
+	if err := CompareHashAndPassword(ctx, hash, []byte("password123")); err != nil {
+		t.Errorf("expected the password to match, got %v", err)
+	}
+	if err := CompareHashAndPassword(ctx, hash, []byte("wrong")); err == nil {
+		t.Error("expected a mismatch")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for i, want := range []struct {
+		name  string
+		match bool
+	}{{"bcrypt.hash", false}, {"bcrypt.compare", true}, {"bcrypt.compare", false}} {
+		if spans[i].Name() != want.name {
+			t.Errorf("span %d: expected name %q, got %q", i, want.name, spans[i].Name())
+		}
+		if cost, _ := spanAttr(spans[i], "bcrypt.cost"); cost.AsInt64() != int64(bcrypt.MinCost) {
+			t.Errorf("span %d: expected cost %d, got %v", i, bcrypt.MinCost, cost.AsInt64())
+		}
+		if want.name == "bcrypt.compare" {
+			if match, _ := spanAttr(spans[i], "bcrypt.match"); match.AsBool() != want.match {
+				t.Errorf("span %d: expected match %v", i, want.match)
+			}
+		}
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := recordSpans(t)
+	tracer := QueryTracer{}
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  "\n\t\tSELECT id FROM users WHERE email = $1",
+		Args: []any{"john@example.com"},
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "UPDATE users SET status = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("deadlock detected")})
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name() != "db.select" || spans[1].Name() != "db.update" {
+		t.Errorf("unexpected span names %q and %q", spans[0].Name(), spans[1].Name())
+	}
+	if rows, _ := spanAttr(spans[0], "db.rows_affected"); rows.AsInt64() != 1 {
+		t.Errorf("expected 1 row affected, got %v", rows.AsInt64())
+	}
+	for _, kv := range spans[0].Attributes() {
+		if kv.Value.Emit() == "john@example.com" {
+			t.Errorf("query argument recorded as %s", kv.Key)
+		}
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("expected the failed query to have error status, got %v", spans[1].Status())
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+// ReadPrimaryHeader lets a client that just wrote data read it back from the
+// primary database instead of a possibly lagging read replica
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// ReadPrimaryMiddleware sends every read of requests carrying
+// "X-Read-Primary: true" to the primary database.
+func ReadPrimaryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get(ReadPrimaryHeader), "true") {
+			r = r.WithContext(models.WithPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+func TestReadPrimaryMiddleware(t *testing.T) {
+	tests := []struct {
+		header  string
+		primary bool
+	}{
+		{"", false},
+		{"false", false},
+		{"true", true},
+		{"TRUE", true},
+	}
+
+	for _, tc := range tests {
+		var primary bool
+		handler := ReadPrimaryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			primary = models.PrimaryRequested(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/users", nil)
+		if tc.header != "" {
+			req.Header.Set(ReadPrimaryHeader, tc.header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if primary != tc.primary {
+			t.Errorf("%s: %q: expected primary %v, got %v", ReadPrimaryHeader, tc.header, tc.primary, primary)
+		}
+	}
+}
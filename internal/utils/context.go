@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+// AuthClaims identifies the caller of a request authenticated by JWTMiddleware
+type AuthClaims struct {
+	UserID int64
+	Role   string
+}
+
+type authClaimsKey struct{}
+
+// WithAuthClaims returns a copy of ctx carrying claims
+func WithAuthClaims(ctx context.Context, claims AuthClaims) context.Context {
+	return context.WithValue(ctx, authClaimsKey{}, claims)
+}
+
+// AuthClaimsFromContext returns the claims stored by JWTMiddleware, if any
+func AuthClaimsFromContext(ctx context.Context) (AuthClaims, bool) {
+	claims, ok := ctx.Value(authClaimsKey{}).(AuthClaims)
+	return claims, ok
+}
+
+// RequireRole is a middleware that only lets callers with the given role
+// through. It must run after JWTMiddleware.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := AuthClaimsFromContext(r.Context())
+		if !ok || claims.Role != role {
+			WriteProblem(w, r, NewProblem(http.StatusForbidden, CodeForbidden, "This action requires the "+role+" role."))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Headers browsers may send and read on cross-origin requests
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID, X-Read-Primary"
+	corsExposedHeaders = "ETag, X-Request-ID"
+	corsMaxAge         = "600" // seconds browsers may cache a preflight
+)
+
+// CORS answers cross-origin requests from a list of allowed origins that can
+// be replaced while the server runs. With no origins, no CORS headers are
+// sent and browsers keep other sites from calling the API.
+type CORS struct {
+	origins atomic.Pointer[[]string]
+}
+
+// NewCORS returns a CORS allowing origins, where "*" allows any origin
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetAllowedOrigins(origins)
+	return c
+}
+
+// SetAllowedOrigins replaces the allowed origins for subsequent requests
+func (c *CORS) SetAllowedOrigins(origins []string) {
+	origins = slices.Clone(origins)
+	c.origins.Store(&origins)
+}
+
+// allows reports whether requests from origin are allowed
+func (c *CORS) allows(origin string) bool {
+	origins := *c.origins.Load()
+	return slices.Contains(origins, "*") || slices.ContainsFunc(origins, func(allowed string) bool {
+		return strings.EqualFold(allowed, origin)
+	})
+}
+
+// Middleware adds the CORS headers for allowed origins and answers their
+// preflight requests. It wraps the router, so preflights reach it even though
+// no route accepts OPTIONS.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cors := NewCORS([]string{"https://app.example.com"})
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "PATCH")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("GET", "https://app.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("expected an allowed origin to be echoed, got %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	w = send("OPTIONS", "https://app.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("expected a preflight answer, got %d %v", w.Code, w.Header())
+	}
+
+	for _, origin := range []string{"", "https://evil.example.com"} {
+		w = send("GET", origin)
+		if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%q: expected no CORS headers, got %v", origin, w.Header())
+		}
+	}
+
+	// Replaced origins apply to the next request
+	cors.SetAllowedOrigins([]string{"https://evil.example.com"})
+	if w = send("GET", "https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Error("expected the new origin to be allowed")
+	}
+	if w = send("GET", "https://app.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected the old origin to be rejected")
+	}
+
+	cors.SetAllowedOrigins([]string{"*"})
+	if w = send("GET", "https://any.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "https://any.example.com" {
+		t.Error("expected * to allow any origin")
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import "strings"
+
+// MatchETag reports whether an If-Match or If-None-Match header value lists
+// etag, or is "*". If-Match uses the strong comparison of RFC 9110, under
+// which weak validators never match; If-None-Match uses the weak one.
+func MatchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
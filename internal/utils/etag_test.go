@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header, etag string
+		weak         bool
+		expected     bool
+	}{
+		{`"1"`, `"1"`, false, true},
+		{`"1"`, `"2"`, false, false},
+		{`"1", "2"`, `"2"`, false, true},
+		{`*`, `"7"`, false, true},
+		{`W/"1"`, `"1"`, false, false},
+		{`W/"1"`, `"1"`, true, true},
+		{`"1"`, `W/"1"`, true, true},
+		{`"1"`, `W/"1"`, false, false},
+		{``, `"1"`, true, false},
+	}
+
+	for _, tc := range tests {
+		if got := MatchETag(tc.header, tc.etag, tc.weak); got != tc.expected {
+			t.Errorf("MatchETag(%q, %q, %v) = %v, expected %v", tc.header, tc.etag, tc.weak, got, tc.expected)
+		}
+	}
+}
@@ -1,60 +1,140 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
 	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var jwtSecretKey string
 
+// TokenClaims are the claims of an access token. Besides the registered
+// claims, it carries the user's ID and role.
+type TokenClaims struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenSettings control the tokens issued by GenerateAccessToken and the
+// login handlers, and the access tokens accepted by JWTMiddleware
+type TokenSettings struct {
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Leeway     time.Duration // clock skew tolerated when checking exp, nbf and iat
+}
+
+// DefaultTokenSettings apply until SetTokenSettings is called
+var DefaultTokenSettings = TokenSettings{
+	Issuer:     "golang-jwt-auth",
+	Audience:   "golang-jwt-auth",
+	AccessTTL:  15 * time.Minute,
+	RefreshTTL: 7 * 24 * time.Hour,
+	Leeway:     30 * time.Second,
+}
+
+var tokenSettings atomic.Pointer[TokenSettings]
+
+// SetTokenSettings replaces the token settings. It is safe to call while
+// requests are served, such as when the configuration is reloaded.
+func SetTokenSettings(settings TokenSettings) {
+	tokenSettings.Store(&settings)
+}
+
+// CurrentTokenSettings returns the settings passed to SetTokenSettings, or
+// DefaultTokenSettings
+func CurrentTokenSettings() TokenSettings {
+	if settings := tokenSettings.Load(); settings != nil {
+		return *settings
+	}
+	return DefaultTokenSettings
+}
+
 // JWTMiddleware is a middleware to validate JWT token in Authorization header
 func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+			WriteProblem(w, r, NewProblem(http.StatusUnauthorized, CodeUnauthorized, "Authorization header missing."))
 			return
 		}
 
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+			WriteProblem(w, r, NewProblem(http.StatusUnauthorized, CodeUnauthorized, "Invalid Authorization header format."))
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if string(jwtSecretKey) == "" {
-			http.Error(w, "Server configuration error", http.StatusInternalServerError)
+			WriteProblem(w, r, InternalError(errors.New("JWT secret is not configured")))
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(jwtSecretKey), nil
-		})
+		// The issuer, audience and times are checked with the same settings
+		// the tokens are issued with
+		settings := CurrentTokenSettings()
+		claims := &TokenClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, signingKey,
+			jwt.WithIssuer(settings.Issuer),
+			jwt.WithAudience(settings.Audience),
+			jwt.WithLeeway(settings.Leeway),
+			jwt.WithIssuedAt(),
+			jwt.WithExpirationRequired(),
+		)
 
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			WriteProblem(w, r, NewProblem(http.StatusUnauthorized, CodeInvalidToken, "Invalid or expired token."))
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		auth := AuthClaims{UserID: claims.UserID, Role: claims.Role}
+
+		ctx := WithAuthClaims(r.Context(), auth)
+		ctx = logging.WithUserID(ctx, auth.UserID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
-func GenerateAccessToken(userID int64) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+// signingKey is the jwt.Keyfunc of JWTMiddleware. Only HMAC signed tokens
+// are accepted.
+func signingKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return []byte(jwtSecretKey), nil
+}
+
+// GenerateAccessToken issues a short-lived access token for a user with the
+// given role
+func GenerateAccessToken(userID int64, role string) (string, error) {
+	settings := CurrentTokenSettings()
+	now := time.Now()
+	claims := TokenClaims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    settings.Issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{settings.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(settings.AccessTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -90,15 +170,20 @@ func GenerateSecureToken(length int) (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
-func HashToken(token string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+func HashToken(ctx context.Context, token string) (string, error) {
+	hash, err := tracing.GenerateFromPassword(ctx, []byte(token), bcrypt.DefaultCost)
 	return string(hash), err
 }
 
-func CompareToken(hash, token string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(token))
+func CompareToken(ctx context.Context, hash, token string) error {
+	return tracing.CompareHashAndPassword(ctx, []byte(hash), []byte(token))
 }
 
 func SetJWTSecrectKey(secret string) {
 	jwtSecretKey = secret
 }
+
+// JWTSecretKeyLoaded reports whether a key for signing tokens has been set
+func JWTSecretKeyLoaded() bool {
+	return jwtSecretKey != ""
+}
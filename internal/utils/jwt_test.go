@@ -72,10 +72,16 @@ func TestJWTMiddleware(t *testing.T) {
 
 func generateTestToken(t *testing.T, secret string) string {
 	t.Helper()
-	claims := jwt.MapClaims{
+	return signTestToken(t, secret, jwt.MapClaims{
 		"user_id": 1,
+		"iss":     DefaultTokenSettings.Issuer,
+		"aud":     DefaultTokenSettings.Audience,
 		"exp":     time.Now().Add(time.Hour).Unix(),
-	}
+	})
+}
+
+func signTestToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
@@ -84,3 +90,127 @@ func generateTestToken(t *testing.T, secret string) string {
 
 	return tokenString
 }
+
+func TestRequireRole(t *testing.T) {
+	SetJWTSecrectKey("testsecretkey")
+
+	var claims AuthClaims
+	handler := JWTMiddleware(RequireRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = AuthClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		role           string
+		expectedStatus int
+	}{
+		{"Admin", "admin", http.StatusOK},
+		{"User", "user", http.StatusForbidden},
+		{"No role claim", "", http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		var token string
+		if tc.role == "" {
+			token = generateTestToken(t, "testsecretkey")
+		} else {
+			var err error
+			if token, err = GenerateAccessToken(7, tc.role); err != nil {
+				t.Fatalf("GenerateAccessToken failed: %v", err)
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.expectedStatus, rr.Code)
+		}
+	}
+
+	if claims.UserID != 7 || claims.Role != "admin" {
+		t.Errorf("expected claims of user 7 with role admin, got %+v", claims)
+	}
+}
+
+func TestGenerateAccessTokenClaims(t *testing.T) {
+	SetJWTSecrectKey("testsecretkey")
+	SetTokenSettings(TokenSettings{Issuer: "auth.example.com", Audience: "api.example.com", AccessTTL: 5 * time.Minute})
+	defer SetTokenSettings(DefaultTokenSettings)
+
+	tokenString, err := GenerateAccessToken(42, "user")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+
+	claims := &TokenClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+
+	if claims.UserID != 42 || claims.Role != "user" || claims.Subject != "42" {
+		t.Errorf("unexpected user claims %+v", claims)
+	}
+	if claims.Issuer != "auth.example.com" || len(claims.Audience) != 1 || claims.Audience[0] != "api.example.com" {
+		t.Errorf("unexpected issuer %q or audience %v", claims.Issuer, claims.Audience)
+	}
+	if claims.IssuedAt == nil || claims.NotBefore == nil || claims.ExpiresAt == nil {
+		t.Fatal("expected iat, nbf and exp to be set")
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != 5*time.Minute {
+		t.Errorf("expected a lifetime of 5m, got %v", ttl)
+	}
+}
+
+func TestJWTMiddlewareChecksRegisteredClaims(t *testing.T) {
+	SetJWTSecrectKey("testsecretkey")
+	SetTokenSettings(TokenSettings{Issuer: "auth.example.com", Audience: "api.example.com", AccessTTL: time.Minute, Leeway: time.Minute})
+	defer SetTokenSettings(DefaultTokenSettings)
+
+	handler := JWTMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	now := time.Now()
+	claims := func(modify func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"user_id": 1,
+			"iss":     "auth.example.com",
+			"aud":     "api.example.com",
+			"iat":     now.Unix(),
+			"exp":     now.Add(time.Minute).Unix(),
+		}
+		modify(c)
+		return c
+	}
+
+	tests := []struct {
+		name           string
+		claims         jwt.MapClaims
+		expectedStatus int
+	}{
+		{"Valid", claims(func(c jwt.MapClaims) {}), http.StatusOK},
+		{"Wrong issuer", claims(func(c jwt.MapClaims) { c["iss"] = "evil.example.com" }), http.StatusUnauthorized},
+		{"Missing issuer", claims(func(c jwt.MapClaims) { delete(c, "iss") }), http.StatusUnauthorized},
+		{"Wrong audience", claims(func(c jwt.MapClaims) { c["aud"] = "other.example.com" }), http.StatusUnauthorized},
+		{"Missing expiry", claims(func(c jwt.MapClaims) { delete(c, "exp") }), http.StatusUnauthorized},
+		{"Expired within leeway", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-30 * time.Second).Unix() }), http.StatusOK},
+		{"Expired beyond leeway", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }), http.StatusUnauthorized},
+		{"Not yet valid", claims(func(c jwt.MapClaims) { c["nbf"] = now.Add(2 * time.Minute).Unix() }), http.StatusUnauthorized},
+		{"Issued in the future", claims(func(c jwt.MapClaims) { c["iat"] = now.Add(2 * time.Minute).Unix() }), http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+signTestToken(t, "testsecretkey", tc.claims))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.expectedStatus, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON merge patches
+const MergePatchContentType = "application/merge-patch+json"
+
+// MergePatch applies an RFC 7396 JSON merge patch to the JSON document target
+// and returns the patched document. Members of a patch object replace the
+// members of the same name in target, objects are merged recursively, null
+// removes a member and any other patch value replaces target entirely.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var targetValue, patchValue any
+	if err := json.Unmarshal(target, &targetValue); err != nil {
+		return nil, fmt.Errorf("invalid merge patch target: %w", err)
+	}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergePatchValue(targetValue, patchValue))
+}
+
+// mergePatchValue implements the MergePatch pseudocode of RFC 7396 section 2
+func mergePatchValue(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatchValue(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMergePatch runs the examples from RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range tests {
+		got, err := MergePatch([]byte(tc.target), []byte(tc.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s) failed: %v", tc.target, tc.patch, err)
+			continue
+		}
+
+		var gotValue, expectedValue any
+		json.Unmarshal(got, &gotValue)
+		json.Unmarshal([]byte(tc.expected), &expectedValue)
+		if !reflect.DeepEqual(gotValue, expectedValue) {
+			t.Errorf("MergePatch(%s, %s) = %s, expected %s", tc.target, tc.patch, got, tc.expected)
+		}
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Errorf("expected an error for a malformed patch")
+	}
+}
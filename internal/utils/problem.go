@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Machine-readable error codes, sent as the "code" member of every problem
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeAccountSuspended     = "account_suspended"
+	CodeInvalidToken         = "invalid_token"
+	CodeExpiredToken         = "expired_token"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeDuplicateEmail       = "duplicate_email"
+	CodeDuplicatePhone       = "duplicate_phone"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object. Problems are errors, so
+// storage and handler code can return them and WriteProblem sends them as is.
+// The cause is logged but never included in the response. WriteProblem sets
+// RequestID so clients can quote it when reporting an error.
+type Problem struct {
+	Type      string           `json:"type"`
+	Title     string           `json:"title"`
+	Status    int              `json:"status"`
+	Detail    string           `json:"detail,omitempty"`
+	Instance  string           `json:"instance,omitempty"`
+	Code      string           `json:"code"`
+	RequestID string           `json:"request_id,omitempty"`
+	Errors    ValidationErrors `json:"errors,omitempty"`
+
+	cause error
+}
+
+// NewProblem returns a problem with the given status, code and human-readable
+// detail. Problems are identified by their code, so the type is always
+// about:blank and the title the status text.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// InternalError returns a 500 problem that hides err from the client
+func InternalError(err error) *Problem {
+	return NewProblem(http.StatusInternalServerError, CodeInternal, "An internal error occurred.").WithCause(err)
+}
+
+// ValidationProblem returns a 400 problem listing every failed rule
+func ValidationProblem(errs ValidationErrors) *Problem {
+	p := NewProblem(http.StatusBadRequest, CodeValidationFailed, "The request body failed validation.")
+	p.Errors = errs
+	return p
+}
+
+// WithCause returns a copy of p that records err for the logs
+func (p *Problem) WithCause(err error) *Problem {
+	c := *p
+	c.cause = err
+	return &c
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Is reports whether target is p or a copy of p made by WithCause
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Status == p.Status && t.Code == p.Code && t.Detail == p.Detail
+}
+
+// ProblemFromError maps err to the problem sent to the client. Problems are
+// returned unchanged, known domain errors get their status and code, and
+// anything else becomes an internal error.
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+
+	var validationErrors ValidationErrors
+	switch {
+	case errors.As(err, &validationErrors):
+		return ValidationProblem(validationErrors)
+	case errors.Is(err, models.ErrNotFound):
+		return NewProblem(http.StatusNotFound, CodeNotFound, "User not found.")
+	case errors.Is(err, models.ErrDuplicateEmail):
+		return NewProblem(http.StatusConflict, CodeDuplicateEmail, "The email is already registered.")
+	case errors.Is(err, models.ErrDuplicatePhone):
+		return NewProblem(http.StatusConflict, CodeDuplicatePhone, "The phone number is already registered.")
+	case errors.Is(err, models.ErrDuplicate):
+		return NewProblem(http.StatusConflict, CodeConflict, "The request conflicts with existing data.")
+	case errors.Is(err, models.ErrInvalidValue):
+		return NewProblem(http.StatusBadRequest, CodeBadRequest, "A value is not accepted by the database.")
+	case errors.Is(err, models.ErrVersionConflict):
+		return NewProblem(http.StatusPreconditionFailed, CodePreconditionFailed, "The user was modified.")
+	case errors.Is(err, models.ErrUserNotDeleted):
+		return NewProblem(http.StatusNotFound, CodeNotFound, "Deleted user not found.")
+	case errors.Is(err, models.ErrInvalidCursor):
+		return NewProblem(http.StatusBadRequest, CodeBadRequest, "Invalid cursor.")
+	case errors.Is(err, models.ErrEmptySearchQuery):
+		return NewProblem(http.StatusBadRequest, CodeBadRequest, "Missing search query q.")
+	default:
+		return InternalError(err)
+	}
+}
+
+// WriteProblem responds with the problem err maps to. Problems carrying a
+// cause, such as internal errors, are logged with the default logger.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := *ProblemFromError(err)
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+	problem.RequestID = logging.RequestIDFromContext(r.Context())
+
+	if problem.cause != nil {
+		slog.ErrorContext(r.Context(), "request failed", "path", r.URL.Path, "status", problem.Status, "code", problem.Code, "error", problem.cause)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
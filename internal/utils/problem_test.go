@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/masudcsesust04/golang-jwt-auth/internal/logging"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
+)
+
+func TestWriteProblem(t *testing.T) {
+	notFound := NewProblem(http.StatusNotFound, CodeNotFound, "User not found.")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"Problem", notFound, http.StatusNotFound, CodeNotFound, "User not found."},
+		{"Problem with cause", notFound.WithCause(errors.New("no rows")), http.StatusNotFound, CodeNotFound, "User not found."},
+		{"Validation errors", ValidateStruct(validationTestRequest{}), http.StatusBadRequest, CodeValidationFailed, "The request body failed validation."},
+		{"Wrapped domain error", fmt.Errorf("failed to update user: %w", models.ErrVersionConflict), http.StatusPreconditionFailed, CodePreconditionFailed, "The user was modified."},
+		{"Not found", fmt.Errorf("failed to get user by id: %w", models.ErrNotFound), http.StatusNotFound, CodeNotFound, "User not found."},
+		{"Duplicate email", fmt.Errorf("failed to create user: %w", fmt.Errorf("%w: %w", models.ErrDuplicateEmail, errors.New("no rows"))), http.StatusConflict, CodeDuplicateEmail, "The email is already registered."},
+		{"Internal error", errors.New(`pq: relation "users" does not exist`), http.StatusInternalServerError, CodeInternal, "An internal error occurred."},
+	}
+
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		WriteProblem(w, httptest.NewRequest("GET", "/users/1", nil), tc.err)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+			t.Errorf("%s: expected content type %q, got %q", tc.name, ProblemContentType, ct)
+		}
+		if strings.Contains(w.Body.String(), "no rows") || strings.Contains(w.Body.String(), "relation") {
+			t.Errorf("%s: response leaks the cause: %s", tc.name, w.Body.String())
+		}
+
+		var problem Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%s: invalid JSON body: %v", tc.name, err)
+		}
+		expected := Problem{Type: "about:blank", Title: http.StatusText(tc.status), Status: tc.status, Detail: tc.detail, Instance: "/users/1", Code: tc.code}
+		problem.Errors = nil
+		if !reflect.DeepEqual(problem, expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, expected, problem)
+		}
+	}
+}
+
+func TestWriteProblemIncludesRequestID(t *testing.T) {
+	handler := logging.AccessLog(slog.New(slog.NewTextHandler(io.Discard, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, CodeNotFound, "User not found."))
+	}))
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if problem.RequestID != "req-1" {
+		t.Errorf("expected request_id req-1, got %q", problem.RequestID)
+	}
+}
+
+func TestValidationProblemListsFields(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteProblem(w, httptest.NewRequest("POST", "/", nil), ValidateStruct(validationTestRequest{Status: "deleted"}))
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if len(problem.Errors) != 2 || problem.Errors[1].Message != "status must be one of active, inactive or banned" {
+		t.Errorf("unexpected body %s", w.Body.String())
+	}
+}
+
+func TestProblemIs(t *testing.T) {
+	problem := NewProblem(http.StatusUnauthorized, CodeInvalidToken, "Invalid refresh token.")
+	err := fmt.Errorf("rotating: %w", problem.WithCause(errors.New("no rows")))
+
+	if !errors.Is(err, problem) {
+		t.Error("expected a copy made by WithCause to match the original problem")
+	}
+	if errors.Is(err, NewProblem(http.StatusUnauthorized, CodeExpiredToken, "Expired refresh token.")) {
+		t.Error("expected problems with different codes not to match")
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"net/http"
 
+	"github.com/masudcsesust04/golang-jwt-auth/internal/metrics"
 	"golang.org/x/time/rate"
 )
 
@@ -18,7 +19,8 @@ func RateLimitMiddleware(limiter *rate.Limiter) func(http.Handler) http.Handler
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !limiter.Allow() {
-				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				metrics.RateLimitRejectionsTotal.WithLabelValues(metrics.RouteTemplate(r)).Inc()
+				WriteProblem(w, r, NewProblem(http.StatusTooManyRequests, CodeRateLimited, "Too many requests, try again later."))
 				return
 			}
 			next.ServeHTTP(w, r)
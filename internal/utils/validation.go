@@ -1,25 +1,159 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
 
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/masudcsesust04/golang-jwt-auth/internal/models"
 )
 
-var validate *validator.Validate
+var (
+	validate *validator.Validate
+	trans    ut.Translator
+)
+
+// e164Pattern matches phone numbers in E.164 format, e.g. +14155552671
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Password policy enforced by the "password" tag. bcrypt ignores everything
+// past 72 bytes.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// customValidations are the tags registered on top of the validator
+// built-ins, with their English messages.
+var customValidations = []struct {
+	tag     string
+	fn      validator.Func
+	message string
+}{
+	{"phone", isE164Phone, "{0} must be a phone number in E.164 format, e.g. +14155552671"},
+	{"user_status", isUserStatus, "{0} must be one of active, inactive or banned"},
+	{"user_role", isUserRole, "{0} must be one of user or admin"},
+	{"password", isStrongPassword, fmt.Sprintf("{0} must be %d to %d characters long and contain at least one letter and one digit", MinPasswordLength, MaxPasswordLength)},
+}
 
 func init() {
-	validate = validator.New()
+	validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by the name clients send them as
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	english := en.New()
+	trans, _ = ut.New(english, english).GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(validate, trans); err != nil {
+		panic(err)
+	}
+
+	for _, v := range customValidations {
+		if err := validate.RegisterValidation(v.tag, v.fn); err != nil {
+			panic(err)
+		}
+
+		message := v.message
+		err := validate.RegisterTranslation(v.tag, trans, func(ut ut.Translator) error {
+			return ut.Add(v.tag, message, false)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T(fe.Tag(), fe.Field())
+			return t
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// FieldError describes a field that failed one validation rule
+type FieldError struct {
+	Field   string `json:"field"`           // JSON name of the field
+	Rule    string `json:"rule"`            // validate tag that failed, e.g. "max"
+	Param   string `json:"param,omitempty"` // parameter of the rule, e.g. "20"
+	Message string `json:"message"`
 }
 
-// ValidateStruct validates a struct based on its 'validate' tags.
-func ValidateStruct(s interface{}) []string {
-	if err := validate.Struct(s); err != nil {
-		var errors []string
-		for _, err := range err.(validator.ValidationErrors) {
-			errors = append(errors, fmt.Sprintf("Field '%s' failed on the '%s' tag", err.Field(), err.Tag()))
+// ValidationErrors lists every failed rule of a struct
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fe := range v {
+		messages[i] = fe.Message
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// ValidateStruct validates a struct based on its 'validate' tags. It returns
+// nil when s is valid.
+func ValidateStruct(s interface{}) ValidationErrors {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return ValidationErrors{{Rule: "invalid", Message: err.Error()}}
+	}
+
+	errs := make(ValidationErrors, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		errs = append(errs, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return errs
+}
+
+func isE164Phone(fl validator.FieldLevel) bool {
+	return e164Pattern.MatchString(fl.Field().String())
+}
+
+func isUserStatus(fl validator.FieldLevel) bool {
+	return models.IsValidStatus(fl.Field().String())
+}
+
+func isUserRole(fl validator.FieldLevel) bool {
+	return models.IsValidRole(fl.Field().String())
+}
+
+// isStrongPassword checks the length and that the password mixes letters and
+// digits
+func isStrongPassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return false
+	}
+
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
 		}
-		return errors
 	}
-	return nil
+	return letter && digit
 }
@@ -0,0 +1,46 @@
+package utils
+
+import "testing"
+
+type validationTestRequest struct {
+	Name     string `json:"name" validate:"required,max=5"`
+	Phone    string `json:"phone_number" validate:"omitempty,phone"`
+	Status   string `json:"status" validate:"omitempty,user_status"`
+	Password string `json:"password" validate:"omitempty,password"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	if errs := ValidateStruct(validationTestRequest{Name: "ok", Phone: "+14155552671", Status: "banned", Password: "s3cretpass"}); errs != nil {
+		t.Fatalf("expected a valid request, got %v", errs)
+	}
+
+	errs := ValidateStruct(validationTestRequest{Name: "too long"})
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	expected := FieldError{Field: "name", Rule: "max", Param: "5", Message: "name must be a maximum of 5 characters in length"}
+	if errs[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, errs[0])
+	}
+
+	tests := []struct {
+		name    string
+		request validationTestRequest
+		field   string
+		rule    string
+	}{
+		{"Missing name", validationTestRequest{}, "name", "required"},
+		{"Phone without plus", validationTestRequest{Name: "a", Phone: "14155552671"}, "phone_number", "phone"},
+		{"Phone too long", validationTestRequest{Name: "a", Phone: "+1234567890123456"}, "phone_number", "phone"},
+		{"Unknown status", validationTestRequest{Name: "a", Status: "deleted"}, "status", "user_status"},
+		{"Short password", validationTestRequest{Name: "a", Password: "ab1"}, "password", "password"},
+		{"Password without digit", validationTestRequest{Name: "a", Password: "onlyletters"}, "password", "password"},
+		{"Password without letter", validationTestRequest{Name: "a", Password: "1234567890"}, "password", "password"},
+	}
+	for _, tc := range tests {
+		errs := ValidateStruct(tc.request)
+		if len(errs) != 1 || errs[0].Field != tc.field || errs[0].Rule != tc.rule || errs[0].Message == "" {
+			t.Errorf("%s: expected %s to fail %s, got %+v", tc.name, tc.field, tc.rule, errs)
+		}
+	}
+}